@@ -2,7 +2,12 @@ package main
 
 import (
 	"Audiophile/database"
+	"Audiophile/identity"
+	"Audiophile/mailer"
 	"Audiophile/server"
+	"Audiophile/signing"
+	"Audiophile/sms"
+	"Audiophile/utilities"
 	"fmt"
 	"github.com/sirupsen/logrus"
 	"os"
@@ -26,6 +31,29 @@ func main() {
 		return
 	}
 	fmt.Println("connected")
+
+	err = signing.Init(os.Getenv("jwt_keys"), os.Getenv("jwt_active_kid"), os.Getenv("jwt_dev_key") == "true")
+	if err != nil {
+		logrus.Printf("signing.Init: error is:%v", err)
+		return
+	}
+	err = utilities.SetTrustedProxies(os.Getenv("trusted_proxies"))
+	if err != nil {
+		logrus.Printf("utilities.SetTrustedProxies: error is:%v", err)
+		return
+	}
+	err = mailer.Init()
+	if err != nil {
+		logrus.Printf("mailer.Init: error is:%v", err)
+		return
+	}
+	sms.Init()
+	err = identity.Init()
+	if err != nil {
+		logrus.Printf("identity.Init: error is:%v", err)
+		return
+	}
+
 	srv := server.SetupRoutes()
 	err = srv.Run(":8080")
 	if err != nil {
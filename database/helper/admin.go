@@ -0,0 +1,199 @@
+package helper
+
+import (
+	"Audiophile/database"
+	"Audiophile/models"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+func FetchAccountStatus(userID uuid.UUID) (models.AccountStatus, error) {
+	SQL := `SELECT  suspended_at IS NOT NULL as suspended,
+                    COALESCE(suspension_reason, '') as suspension_reason
+            FROM    users
+            WHERE   id=$1
+            AND     archived_at IS NULL`
+
+	var status models.AccountStatus
+
+	err := database.AudiophileDB.Get(&status, SQL, userID)
+	if err != nil {
+		logrus.Printf("FetchAccountStatus: cannot get account status:%v", err)
+		return status, err
+	}
+	return status, nil
+}
+
+func FetchAdminUserDetails(userID uuid.UUID) (models.AdminUserDetails, error) {
+	SQL := `SELECT  users.id,
+                    name,
+                    email,
+                    phone_no,
+                    COALESCE(age, 0) as age,
+                    email_verified_at IS NOT NULL as email_verified,
+                    phone_verified_at IS NOT NULL as phone_verified,
+                    users.created_at,
+                    suspended_at,
+                    COALESCE(suspension_reason, '') as suspension_reason,
+                    COALESCE(array_agg(roles.role ORDER BY roles.role) FILTER (WHERE roles.role IS NOT NULL), '{}') as roles
+            FROM    users
+            LEFT JOIN roles ON roles.user_id = users.id
+            WHERE   users.id=$1
+            AND     users.archived_at IS NULL
+            GROUP BY users.id`
+
+	var userDetails models.AdminUserDetails
+
+	err := database.AudiophileDB.Get(&userDetails, SQL, userID)
+	if err != nil {
+		logrus.Printf("FetchAdminUserDetails: cannot get user:%v", err)
+		return userDetails, err
+	}
+	return userDetails, nil
+}
+
+// SuspendUser blocks an account from logging in, it reports false when the account does not
+// exist or is already suspended
+func SuspendUser(userID uuid.UUID, reason string, tx *sqlx.Tx) (bool, error) {
+	SQL := `UPDATE  users
+            SET     suspended_at=now(),
+                    suspension_reason=$2,
+                    updated_at=now()
+            WHERE   id=$1
+            AND     suspended_at IS NULL
+            AND     archived_at IS NULL`
+
+	result, err := tx.Exec(SQL, userID, reason)
+	if err != nil {
+		logrus.Printf("SuspendUser: cannot suspend user:%v", err)
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		logrus.Printf("SuspendUser: cannot get affected rows:%v", err)
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+func ReactivateUser(userID uuid.UUID, tx *sqlx.Tx) (bool, error) {
+	SQL := `UPDATE  users
+            SET     suspended_at=NULL,
+                    suspension_reason=NULL,
+                    updated_at=now()
+            WHERE   id=$1
+            AND     suspended_at IS NOT NULL
+            AND     archived_at IS NULL`
+
+	result, err := tx.Exec(SQL, userID)
+	if err != nil {
+		logrus.Printf("ReactivateUser: cannot reactivate user:%v", err)
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		logrus.Printf("ReactivateUser: cannot get affected rows:%v", err)
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// RemoveUserRole takes a role away from a user but never the last one, a user without any role
+// could not log in anymore
+func RemoveUserRole(userID uuid.UUID, role string, tx *sqlx.Tx) (bool, error) {
+	SQL := `DELETE FROM roles
+            WHERE  user_id=$1
+            AND    role=$2
+            AND    (SELECT count(*) FROM roles WHERE user_id=$1) > 1`
+
+	result, err := tx.Exec(SQL, userID, role)
+	if err != nil {
+		logrus.Printf("RemoveUserRole: cannot remove role:%v", err)
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		logrus.Printf("RemoveUserRole: cannot get affected rows:%v", err)
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// RecordAdminAction writes an entry to the audit log, details is stored as json
+func RecordAdminAction(actorID uuid.UUID, action string, targetUserID uuid.UUID, details map[string]interface{}, tx *sqlx.Tx) error {
+	if details == nil {
+		details = make(map[string]interface{})
+	}
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		logrus.Printf("RecordAdminAction: cannot encode details:%v", err)
+		return err
+	}
+
+	SQL := `INSERT INTO admin_audit_log(actor_id, action, target_user_id, details)
+            VALUES   ($1, $2, $3, $4)`
+
+	_, err = tx.Exec(SQL, actorID, action, targetUserID, string(detailsJSON))
+	if err != nil {
+		logrus.Printf("RecordAdminAction: cannot record action:%v", err)
+		return err
+	}
+	return nil
+}
+
+// GetAuditLog lists audit entries newest first, limited to one target user when targetUserID is set
+func GetAuditLog(targetUserID *uuid.UUID, filterCheck models.FiltersCheck) (models.TotalAuditEntries, error) {
+	SQL := `SELECT  count(*) over () as total_count,
+                    admin_audit_log.id,
+                    actor_id,
+                    users.email as actor_email,
+                    action,
+                    target_user_id,
+                    details,
+                    admin_audit_log.created_at
+            FROM    admin_audit_log
+            JOIN    users ON users.id = admin_audit_log.actor_id
+            WHERE   ($1::uuid IS NULL OR target_user_id=$1)
+            ORDER BY admin_audit_log.created_at DESC
+            LIMIT $2 OFFSET $3`
+
+	totalEntries := models.TotalAuditEntries{Entries: make([]models.AuditEntry, 0)}
+
+	err := database.AudiophileDB.Select(&totalEntries.Entries, SQL, targetUserID, filterCheck.Limit, filterCheck.Limit*filterCheck.Page)
+	if err != nil {
+		logrus.Printf("GetAuditLog: cannot get audit log:%v", err)
+		return totalEntries, err
+	}
+
+	if len(totalEntries.Entries) > 0 {
+		totalEntries.TotalCount = totalEntries.Entries[0].TotalCount
+	}
+	return totalEntries, nil
+}
+
+// RecordImpersonatedRequest audits a single request made with an impersonation token, it runs
+// outside of any transaction of the handler so failed requests are recorded as well
+func RecordImpersonatedRequest(impersonatorID, userID, sessionID uuid.UUID, method, path string, status int) error {
+	details, err := json.Marshal(map[string]interface{}{
+		"sessionId": sessionID,
+		"method":    method,
+		"path":      path,
+		"status":    status,
+	})
+	if err != nil {
+		logrus.Printf("RecordImpersonatedRequest: cannot encode details:%v", err)
+		return err
+	}
+
+	SQL := `INSERT INTO admin_audit_log(actor_id, action, target_user_id, details)
+            VALUES   ($1, $2, $3, $4)`
+
+	_, err = database.AudiophileDB.Exec(SQL, impersonatorID, models.AuditImpersonatedRequest, userID, string(details))
+	if err != nil {
+		logrus.Printf("RecordImpersonatedRequest: cannot record request:%v", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package helper
+
+import (
+	"Audiophile/database"
+	"Audiophile/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+func CreateAPIKey(name, prefix, keyHash string, scopes []string, expiresAt *time.Time, createdBy uuid.UUID) (models.APIKey, error) {
+	SQL := `INSERT INTO api_keys(name, prefix, key_hash, scopes, expires_at, created_by)
+            VALUES   ($1, $2, $3, $4, $5, $6)
+            RETURNING id, name, prefix, scopes, created_by, expires_at, last_used_at, revoked_at, created_at`
+
+	var apiKey models.APIKey
+
+	err := database.AudiophileDB.Get(&apiKey, SQL, name, prefix, keyHash, pq.StringArray(scopes), expiresAt, createdBy)
+	if err != nil {
+		logrus.Printf("CreateAPIKey: cannot create api key:%v", err)
+		return apiKey, err
+	}
+	return apiKey, nil
+}
+
+func GetAPIKeys() ([]models.APIKey, error) {
+	SQL := `SELECT  id,
+                    name,
+                    prefix,
+                    scopes,
+                    created_by,
+                    expires_at,
+                    last_used_at,
+                    revoked_at,
+                    created_at
+            FROM    api_keys
+            ORDER BY created_at DESC`
+
+	apiKeys := make([]models.APIKey, 0)
+
+	err := database.AudiophileDB.Select(&apiKeys, SQL)
+	if err != nil {
+		logrus.Printf("GetAPIKeys: cannot get api keys:%v", err)
+		return apiKeys, err
+	}
+	return apiKeys, nil
+}
+
+func RevokeAPIKey(keyID, revokedBy uuid.UUID) (bool, error) {
+	SQL := `UPDATE  api_keys
+            SET     revoked_at=now(),
+                    revoked_by=$2
+            WHERE   id=$1
+            AND     revoked_at IS NULL`
+
+	result, err := database.AudiophileDB.Exec(SQL, keyID, revokedBy)
+	if err != nil {
+		logrus.Printf("RevokeAPIKey: cannot revoke api key:%v", err)
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		logrus.Printf("RevokeAPIKey: cannot get affected rows:%v", err)
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// UseAPIKey looks up an active key by its hash and records that it was used, it returns
+// sql.ErrNoRows for unknown, revoked or expired keys and for keys whose creator can no longer log in
+func UseAPIKey(keyHash string) (models.APIKeyPrincipal, error) {
+	SQL := `UPDATE  api_keys
+            SET     last_used_at=now()
+            FROM    users
+            WHERE   key_hash=$1
+            AND     revoked_at IS NULL
+            AND     (expires_at IS NULL OR expires_at > now())
+            AND     users.id=api_keys.created_by
+            AND     users.suspended_at IS NULL
+            AND     users.archived_at IS NULL
+            RETURNING api_keys.id, created_by, scopes`
+
+	var principal models.APIKeyPrincipal
+
+	err := database.AudiophileDB.Get(&principal, SQL, keyHash)
+	if err != nil {
+		logrus.Printf("UseAPIKey: api key not usable:%v", err)
+		return principal, err
+	}
+	return principal, nil
+}
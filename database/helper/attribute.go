@@ -0,0 +1,186 @@
+package helper
+
+import (
+	"Audiophile/database"
+	"Audiophile/models"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// ancestorsSQL selects category $1 and every category above it
+const ancestorsSQL = `WITH RECURSIVE ancestors AS (
+                          SELECT id, parent_id FROM category WHERE id = $1
+                          UNION
+                          SELECT category.id, category.parent_id
+                          FROM   category
+                          JOIN   ancestors ON category.id = ancestors.parent_id
+                      )`
+
+const attributeDefinitionColumns = `attribute_definitions.id,
+                                    attribute_definitions.category_id,
+                                    attribute_definitions.key,
+                                    attribute_definitions.name,
+                                    attribute_definitions.type,
+                                    attribute_definitions.unit,
+                                    attribute_definitions.allowed_values,
+                                    attribute_definitions.min_value,
+                                    attribute_definitions.max_value,
+                                    attribute_definitions.required`
+
+// GetCategoryAttributes returns the attribute definitions that apply to the products of a category,
+// its own and the ones inherited from the categories above it
+func GetCategoryAttributes(categoryID uuid.UUID) ([]models.AttributeDefinition, error) {
+	SQL := ancestorsSQL + `
+            SELECT   ` + attributeDefinitionColumns + `
+            FROM     attribute_definitions
+            JOIN     ancestors ON ancestors.id = attribute_definitions.category_id
+            WHERE    attribute_definitions.archived_at IS NULL
+            ORDER BY attribute_definitions.name, attribute_definitions.key`
+
+	definitions := make([]models.AttributeDefinition, 0)
+	err := database.AudiophileDB.Select(&definitions, SQL, categoryID)
+	if err != nil {
+		logrus.Printf("GetCategoryAttributes: cannot get attribute definitions:%v", err)
+		return definitions, err
+	}
+	return definitions, nil
+}
+
+// AddAttributeDefinition returns sql.ErrNoRows when the key is already defined above or below the
+// category, a product could otherwise see the same key twice
+func AddAttributeDefinition(definition models.AttributeDefinition) (uuid.UUID, error) {
+	SQL := ancestorsSQL + `, descendants AS (
+                SELECT id FROM category WHERE id = $1
+                UNION
+                SELECT category.id
+                FROM   category
+                JOIN   descendants ON category.parent_id = descendants.id
+            )
+            INSERT INTO attribute_definitions(category_id, key, name, type, unit, allowed_values, min_value, max_value, required)
+            SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9
+            WHERE  NOT EXISTS(SELECT 1
+                              FROM   attribute_definitions
+                              WHERE  key = $2
+                              AND    archived_at IS NULL
+                              AND    (category_id IN (SELECT id FROM ancestors) OR category_id IN (SELECT id FROM descendants)))
+            RETURNING id`
+
+	var definitionID uuid.UUID
+	err := database.AudiophileDB.Get(&definitionID, SQL, definition.CategoryID, definition.Key, definition.Name, definition.Type,
+		definition.Unit, definition.AllowedValues, definition.MinValue, definition.MaxValue, definition.Required)
+	if err != nil {
+		logrus.Printf("AddAttributeDefinition: cannot add attribute definition:%v", err)
+		return definitionID, err
+	}
+	return definitionID, nil
+}
+
+// ArchiveAttributeDefinition hides the attribute, the values products have for it are kept
+func ArchiveAttributeDefinition(categoryID uuid.UUID, key string) (bool, error) {
+	SQL := `UPDATE  attribute_definitions
+            SET     archived_at = now()
+            WHERE   category_id = $1
+            AND     key = $2
+            AND     archived_at IS NULL`
+	result, err := database.AudiophileDB.Exec(SQL, categoryID, key)
+	if err != nil {
+		logrus.Printf("ArchiveAttributeDefinition: cannot archive attribute definition:%v", err)
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+func FetchProductCategory(productID uuid.UUID) (uuid.UUID, error) {
+	SQL := `SELECT  category_id
+            FROM    inventory
+            WHERE   id = $1
+            AND     archived_at IS NULL`
+	var categoryID uuid.UUID
+	err := database.AudiophileDB.Get(&categoryID, SQL, productID)
+	if err != nil {
+		logrus.Printf("FetchProductCategory: cannot get product category:%v", err)
+		return categoryID, err
+	}
+	return categoryID, nil
+}
+
+func SetProductAttributes(productID uuid.UUID, values map[uuid.UUID]models.AttributeValue, tx *sqlx.Tx) error {
+	SQL := `INSERT INTO product_attributes(product_id, definition_id, number_value, range_min, range_max, text_value, bool_value)
+            VALUES      ($1, $2, $3, $4, $5, $6, $7)
+            ON CONFLICT (product_id, definition_id) DO UPDATE
+            SET         number_value = EXCLUDED.number_value,
+                        range_min = EXCLUDED.range_min,
+                        range_max = EXCLUDED.range_max,
+                        text_value = EXCLUDED.text_value,
+                        bool_value = EXCLUDED.bool_value,
+                        updated_at = now()`
+
+	for definitionID, value := range values {
+		_, err := tx.Exec(SQL, productID, definitionID, value.Number, value.RangeMin, value.RangeMax, value.Text, value.Bool)
+		if err != nil {
+			logrus.Printf("SetProductAttributes: cannot set product attribute:%v", err)
+			return err
+		}
+	}
+	return nil
+}
+
+func RemoveProductAttributes(productID uuid.UUID, definitionIDs []string, tx *sqlx.Tx) error {
+	SQL := `DELETE FROM product_attributes
+            WHERE       product_id = $1
+            AND         definition_id = ANY($2::uuid[])`
+	_, err := tx.Exec(SQL, productID, pq.StringArray(definitionIDs))
+	if err != nil {
+		logrus.Printf("RemoveProductAttributes: cannot remove product attributes:%v", err)
+		return err
+	}
+	return nil
+}
+
+func GetProductAttributes(productID uuid.UUID) ([]models.ProductAttribute, error) {
+	SQL := `SELECT   attribute_definitions.key,
+                     attribute_definitions.name,
+                     attribute_definitions.type,
+                     attribute_definitions.unit,
+                     product_attributes.number_value,
+                     product_attributes.range_min,
+                     product_attributes.range_max,
+                     product_attributes.text_value,
+                     product_attributes.bool_value
+            FROM     product_attributes
+            JOIN     attribute_definitions ON attribute_definitions.id = product_attributes.definition_id
+            WHERE    product_attributes.product_id = $1
+            AND      attribute_definitions.archived_at IS NULL
+            ORDER BY attribute_definitions.name, attribute_definitions.key`
+
+	rows := make([]struct {
+		Key  string  `db:"key"`
+		Name string  `db:"name"`
+		Type string  `db:"type"`
+		Unit *string `db:"unit"`
+		models.AttributeValue
+	}, 0)
+	err := database.AudiophileDB.Select(&rows, SQL, productID)
+	if err != nil {
+		logrus.Printf("GetProductAttributes: cannot get product attributes:%v", err)
+		return nil, err
+	}
+
+	attributes := make([]models.ProductAttribute, 0, len(rows))
+	for _, row := range rows {
+		attributes = append(attributes, models.ProductAttribute{
+			Key:   row.Key,
+			Name:  row.Name,
+			Type:  row.Type,
+			Unit:  row.Unit,
+			Value: row.AttributeValue.Display(row.Type),
+		})
+	}
+	return attributes, nil
+}
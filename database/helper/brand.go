@@ -0,0 +1,89 @@
+package helper
+
+import (
+	"Audiophile/database"
+	"Audiophile/models"
+	"github.com/sirupsen/logrus"
+)
+
+const brandColumns = `brands.id,
+                      COALESCE(brands.brand_name, '') as name,
+                      COALESCE(brands.brand_description, '') as description,
+                      brands.slug,
+                      brands.logo_image_id,
+                      images.url as logo_url,
+                      brands.created_at,
+                      brands.updated_at,
+                      brands.archived_at`
+
+func GetBrands(includeArchived bool) ([]models.Brand, error) {
+	SQL := `SELECT    ` + brandColumns + `
+            FROM      brands
+            LEFT JOIN images ON images.id = brands.logo_image_id
+            WHERE     $1 OR brands.archived_at IS NULL
+            ORDER BY  name, brands.id`
+
+	brands := make([]models.Brand, 0)
+	err := database.AudiophileDB.Select(&brands, SQL, includeArchived)
+	if err != nil {
+		logrus.Printf("GetBrands: cannot get brands:%v", err)
+		return brands, err
+	}
+	return brands, nil
+}
+
+func FetchBrandBySlug(slug string) (models.Brand, error) {
+	SQL := `SELECT    ` + brandColumns + `
+            FROM      brands
+            LEFT JOIN images ON images.id = brands.logo_image_id
+            WHERE     brands.slug = $1
+            AND       brands.archived_at IS NULL`
+
+	var brand models.Brand
+	err := database.AudiophileDB.Get(&brand, SQL, slug)
+	if err != nil {
+		logrus.Printf("FetchBrandBySlug: cannot get brand:%v", err)
+		return brand, err
+	}
+	return brand, nil
+}
+
+func UpdateBrand(brandID int, update models.BrandUpdate) (bool, error) {
+	SQL := `UPDATE  brands
+            SET     brand_name = COALESCE($2, brand_name),
+                    brand_description = COALESCE($3, brand_description),
+                    slug = COALESCE($4, slug),
+                    logo_image_id = COALESCE($5, logo_image_id),
+                    updated_at = now()
+            WHERE   id = $1
+            AND     archived_at IS NULL`
+	result, err := database.AudiophileDB.Exec(SQL, brandID, update.BrandName, update.BrandDescription, update.Slug, update.LogoImageID)
+	if err != nil {
+		logrus.Printf("UpdateBrand: cannot update brand:%v", err)
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// ArchiveBrand hides a brand from the storefront, brands that still have products are kept
+func ArchiveBrand(brandID int) (bool, error) {
+	SQL := `UPDATE  brands
+            SET     archived_at = now()
+            WHERE   id = $1
+            AND     archived_at IS NULL
+            AND     NOT EXISTS(SELECT 1 FROM inventory WHERE brand_id = $1 AND inventory.archived_at IS NULL)`
+	result, err := database.AudiophileDB.Exec(SQL, brandID)
+	if err != nil {
+		logrus.Printf("ArchiveBrand: cannot archive brand:%v", err)
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
@@ -0,0 +1,449 @@
+package helper
+
+import (
+	"Audiophile/database"
+	"Audiophile/models"
+	"encoding/json"
+	"github.com/elgris/sqrl"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+	"strings"
+)
+
+// catalogFilter names one of the product filters, a facet leaves its own filter out
+type catalogFilter int
+
+const (
+	filterName catalogFilter = iota
+	filterBrand
+	filterCategory
+	filterPrice
+	filterInStock
+)
+
+// the name search matches the weighted search_vector of a product and, to forgive typos, trigram word
+// similarity against its name. Both placeholders take the searched name
+const filterNameSQL = `(inventory.search_vector @@ websearch_to_tsquery('english', ?) OR ? <% inventory.name)`
+
+// subcategoriesSQL selects the categories in its placeholder together with all categories below them
+const subcategoriesSQL = `WITH RECURSIVE subcategories AS (
+                              SELECT id FROM category WHERE id = ANY(?::uuid[])
+                              UNION
+                              SELECT category.id
+                              FROM   category
+                              JOIN   subcategories ON category.parent_id = subcategories.id
+                              WHERE  category.archived_at IS NULL
+                          )
+                          SELECT id FROM subcategories`
+
+const (
+	relevanceSQL  = `ts_rank(inventory.search_vector, websearch_to_tsquery('english', ?))::float8`
+	similaritySQL = `word_similarity(?, inventory.name)::float8`
+	// units sold are aggregated once per query by unitsSoldJoinSQL rather than once per product and key
+	unitsSoldSQL = `COALESCE(units_sold.units, 0)::float8`
+	// unrated products average 0 which puts them after every rated one
+	averageRatingSQL = `(SELECT COALESCE(avg(rating), 0)::float8 FROM product_ratings WHERE product_ratings.product_id = inventory.id)`
+	ratingCountSQL   = `(SELECT count(*)::float8 FROM product_ratings WHERE product_ratings.product_id = inventory.id)`
+)
+
+// unitsSoldJoinSQL sums the quantities of completed orders per product for the best selling sort
+const unitsSoldJoinSQL = `(SELECT   user_cart_products.product_id,
+                                   sum(user_cart_products.quantity) as units
+                          FROM     order_details
+                          CROSS JOIN LATERAL unnest(order_details.cart_id) AS ordered(cart_id)
+                          JOIN     user_cart_products ON user_cart_products.id = ordered.cart_id
+                          WHERE    order_details.status = 'completed'
+                          GROUP BY user_cart_products.product_id) units_sold ON units_sold.product_id = inventory.id`
+
+var (
+	byProductName = []sortKey{{expr: "inventory.name", cast: "text"}, {expr: "inventory.id", cast: "uuid"}}
+
+	// productSortKeys maps the sort keys to their keyset order, the product id breaks the remaining
+	// ties so that paging through a sort stays consistent. Relevance ranks against the searched name
+	// and is built by catalogSortKeys
+	productSortKeys = map[string][]sortKey{
+		models.SortName: byProductName,
+		models.SortPriceAsc: {
+			{expr: "inventory.price", cast: "float8"},
+			{expr: "inventory.id", cast: "uuid"},
+		},
+		models.SortPriceDesc: {
+			{expr: "inventory.price", cast: "float8", desc: true},
+			{expr: "inventory.id", cast: "uuid"},
+		},
+		models.SortNewest: {
+			{expr: "inventory.created_at", cast: "timestamptz", desc: true},
+			{expr: "inventory.id", cast: "uuid"},
+		},
+		models.SortBestSelling: append([]sortKey{
+			{expr: unitsSoldSQL, cast: "float8", desc: true},
+		}, byProductName...),
+		models.SortTopRated: append([]sortKey{
+			{expr: averageRatingSQL, cast: "float8", desc: true},
+			{expr: ratingCountSQL, cast: "float8", desc: true},
+		}, byProductName...),
+	}
+)
+
+// productSortJoins are the tables a sort needs joined to inventory for its keys
+var productSortJoins = map[string]string{
+	models.SortBestSelling: unitsSoldJoinSQL,
+}
+
+func catalogSortKeys(filterCheck models.FiltersCheck) []sortKey {
+	if filterCheck.Sort == models.SortRelevance {
+		return append([]sortKey{
+			{expr: relevanceSQL, args: []interface{}{filterCheck.SearchedName}, cast: "float8", desc: true},
+			{expr: similaritySQL, args: []interface{}{filterCheck.SearchedName}, cast: "float8", desc: true},
+		}, byProductName...)
+	}
+	keys, ok := productSortKeys[filterCheck.Sort]
+	if !ok {
+		return byProductName
+	}
+	return keys
+}
+
+// catalogWhere builds the where clause of a product query from the filters that are set, leaving out
+// the skipped ones. Archived products are always left out
+func catalogWhere(filterCheck models.FiltersCheck, skip ...catalogFilter) sqrl.And {
+	skipped := func(filter catalogFilter) bool {
+		for _, skip := range skip {
+			if skip == filter {
+				return true
+			}
+		}
+		return false
+	}
+
+	where := sqrl.And{sqrl.Expr("inventory.archived_at IS NULL")}
+	if filterCheck.IsSearched && !skipped(filterName) {
+		where = append(where, sqrl.Expr(filterNameSQL, filterCheck.SearchedName, filterCheck.SearchedName))
+	}
+	if len(filterCheck.BrandIDs) > 0 && !skipped(filterBrand) {
+		where = append(where, sqrl.Expr("inventory.brand_id = ANY(?::int[])", filterCheck.BrandIDs))
+	}
+	if len(filterCheck.CategoryIDs) > 0 && !skipped(filterCategory) {
+		where = append(where, sqrl.Expr("inventory.category_id IN ("+subcategoriesSQL+")", filterCheck.CategoryIDs))
+	}
+	if filterCheck.MinPrice != nil && !skipped(filterPrice) {
+		where = append(where, sqrl.Expr("inventory.price >= ?", *filterCheck.MinPrice))
+	}
+	if filterCheck.MaxPrice != nil && !skipped(filterPrice) {
+		where = append(where, sqrl.Expr("inventory.price <= ?", *filterCheck.MaxPrice))
+	}
+	if filterCheck.InStock && !skipped(filterInStock) {
+		where = append(where, sqrl.Expr("inventory.quantity > 0"))
+	}
+	if len(filterCheck.Attributes) > 0 {
+		where = append(where, attributeFilters(filterCheck.Attributes))
+	}
+	return where
+}
+
+// filterAttributesSQL keeps the products that match every attribute filter of the json array in its
+// placeholder
+const filterAttributesSQL = `NOT EXISTS(SELECT 1
+                                      FROM   json_to_recordset(?::json) AS attribute_filter(key TEXT, one_of TEXT[], min FLOAT, max FLOAT)
+                                      WHERE  NOT EXISTS(SELECT 1
+                                                        FROM   product_attributes
+                                                        JOIN   attribute_definitions ON attribute_definitions.id = product_attributes.definition_id
+                                                        WHERE  product_attributes.product_id = inventory.id
+                                                        AND    attribute_definitions.key = attribute_filter.key
+                                                        AND    attribute_definitions.archived_at IS NULL
+                                                        AND    (attribute_filter.one_of IS NULL OR COALESCE(product_attributes.text_value, product_attributes.bool_value::text) = ANY(attribute_filter.one_of))
+                                                        AND    (attribute_filter.min IS NULL OR product_attributes.number_value >= attribute_filter.min OR product_attributes.range_min <= attribute_filter.min)
+                                                        AND    (attribute_filter.max IS NULL OR product_attributes.number_value <= attribute_filter.max OR product_attributes.range_max >= attribute_filter.max)))`
+
+// attributeFilters binds the attribute filters as the json array filterAttributesSQL reads
+type attributeFilters []models.AttributeFilter
+
+func (filters attributeFilters) ToSql() (string, []interface{}, error) {
+	data, err := json.Marshal(filters)
+	if err != nil {
+		return "", nil, err
+	}
+	return filterAttributesSQL, []interface{}{string(data)}, nil
+}
+
+func GetProductFacets(filterCheck models.FiltersCheck) (models.ProductFacets, error) {
+	facets := models.ProductFacets{
+		Brands:     make([]models.BrandFacet, 0),
+		Categories: make([]models.CategoryFacet, 0),
+	}
+	psql := sqrl.StatementBuilder.PlaceholderFormat(sqrl.Dollar)
+
+	SQL, args, err := psql.Select("brands.id", "COALESCE(brands.brand_name, '') as name", "count(*) as count").
+		From("inventory").
+		Join("brands ON brands.id = inventory.brand_id").
+		Where(catalogWhere(filterCheck, filterBrand)).
+		GroupBy("brands.id").
+		OrderBy("count DESC", "name").
+		ToSql()
+	if err != nil {
+		logrus.Printf("GetProductFacets: not able to create sql string: %v", err)
+		return facets, err
+	}
+
+	err = database.AudiophileDB.Select(&facets.Brands, SQL, args...)
+	if err != nil {
+		logrus.Printf("GetProductFacets: cannot get brand facets:%v", err)
+		return facets, err
+	}
+
+	SQL, args, err = psql.Select("category.id", "category.name", "count(*) as count").
+		From("inventory").
+		Join("category ON category.id = inventory.category_id").
+		Where(catalogWhere(filterCheck, filterCategory)).
+		GroupBy("category.id").
+		OrderBy("count DESC", "category.name").
+		ToSql()
+	if err != nil {
+		logrus.Printf("GetProductFacets: not able to create sql string: %v", err)
+		return facets, err
+	}
+
+	err = database.AudiophileDB.Select(&facets.Categories, SQL, args...)
+	if err != nil {
+		logrus.Printf("GetProductFacets: cannot get category facets:%v", err)
+		return facets, err
+	}
+
+	SQL, args, err = psql.Select("COALESCE(min(price), 0) as min", "COALESCE(max(price), 0) as max").
+		From("inventory").
+		Where(catalogWhere(filterCheck, filterPrice)).
+		ToSql()
+	if err != nil {
+		logrus.Printf("GetProductFacets: not able to create sql string: %v", err)
+		return facets, err
+	}
+
+	err = database.AudiophileDB.Get(&facets.PriceRange, SQL, args...)
+	if err != nil {
+		logrus.Printf("GetProductFacets: cannot get price range:%v", err)
+		return facets, err
+	}
+
+	SQL, args, err = psql.Select("count(*)").
+		From("inventory").
+		Where(catalogWhere(filterCheck, filterInStock)).
+		Where("inventory.quantity > 0").
+		ToSql()
+	if err != nil {
+		logrus.Printf("GetProductFacets: not able to create sql string: %v", err)
+		return facets, err
+	}
+
+	err = database.AudiophileDB.Get(&facets.InStock, SQL, args...)
+	if err != nil {
+		logrus.Printf("GetProductFacets: cannot get stock count:%v", err)
+		return facets, err
+	}
+
+	facets.Attributes, err = getAttributeFacets(filterCheck)
+	if err != nil {
+		return facets, err
+	}
+	return facets, nil
+}
+
+// attributeFacetRow is one value, or the number range, of an attribute among the filtered products
+type attributeFacetRow struct {
+	Key   string   `db:"key"`
+	Name  string   `db:"name"`
+	Type  string   `db:"type"`
+	Unit  *string  `db:"unit"`
+	Value *string  `db:"value"`
+	Count int      `db:"count"`
+	Min   *float64 `db:"min"`
+	Max   *float64 `db:"max"`
+}
+
+// getAttributeFacets counts the attribute values of the filtered products. The attributes that are
+// filtered on are counted apart with the other filters only, like the other facets
+func getAttributeFacets(filterCheck models.FiltersCheck) ([]models.AttributeFacet, error) {
+	filteredKeys := make([]string, 0, len(filterCheck.Attributes))
+	for _, filter := range filterCheck.Attributes {
+		filteredKeys = append(filteredKeys, filter.Key)
+	}
+
+	rows, err := attributeFacetRows(filterCheck, sqrl.Expr("NOT attribute_definitions.key = ANY(?::text[])", pq.StringArray(filteredKeys)))
+	if err != nil {
+		return nil, err
+	}
+
+	for i, filter := range filterCheck.Attributes {
+		others := filterCheck
+		others.Attributes = append(append([]models.AttributeFilter{}, filterCheck.Attributes[:i]...), filterCheck.Attributes[i+1:]...)
+
+		keyRows, err := attributeFacetRows(others, sqrl.Expr("attribute_definitions.key = ?", filter.Key))
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, keyRows...)
+	}
+
+	facets := make([]models.AttributeFacet, 0)
+	byKey := make(map[string]int)
+	for _, row := range rows {
+		i, ok := byKey[row.Key]
+		if !ok {
+			i = len(facets)
+			byKey[row.Key] = i
+			facets = append(facets, models.AttributeFacet{Key: row.Key, Name: row.Name, Type: row.Type, Unit: row.Unit})
+		}
+		if row.Value != nil {
+			facets[i].Values = append(facets[i].Values, models.AttributeFacetValue{Value: *row.Value, Count: row.Count})
+			continue
+		}
+		facets[i].Min, facets[i].Max = row.Min, row.Max
+	}
+	return facets, nil
+}
+
+// attributeFacetRows counts the values of the attributes that keys selects among the products that
+// match filterCheck
+func attributeFacetRows(filterCheck models.FiltersCheck, keys sqrl.Sqlizer) ([]attributeFacetRow, error) {
+	rows := make([]attributeFacetRow, 0)
+
+	psql := sqrl.StatementBuilder.PlaceholderFormat(sqrl.Dollar)
+	SQL, args, err := psql.Select("attribute_definitions.key",
+		"min(attribute_definitions.name) as name",
+		"attribute_definitions.type",
+		"min(attribute_definitions.unit) as unit",
+		"COALESCE(product_attributes.text_value, product_attributes.bool_value::text) as value",
+		"count(DISTINCT inventory.id) as count",
+		"min(COALESCE(product_attributes.number_value, product_attributes.range_min)) as min",
+		"max(COALESCE(product_attributes.number_value, product_attributes.range_max)) as max").
+		From("inventory").
+		Join("product_attributes ON product_attributes.product_id = inventory.id").
+		Join("attribute_definitions ON attribute_definitions.id = product_attributes.definition_id").
+		Where(catalogWhere(filterCheck)).
+		Where("attribute_definitions.archived_at IS NULL").
+		Where(keys).
+		GroupBy("attribute_definitions.key", "attribute_definitions.type", "value").
+		OrderBy("attribute_definitions.key", "count DESC", "value").
+		ToSql()
+	if err != nil {
+		logrus.Printf("attributeFacetRows: not able to create sql string: %v", err)
+		return rows, err
+	}
+
+	err = database.AudiophileDB.Select(&rows, SQL, args...)
+	if err != nil {
+		logrus.Printf("attributeFacetRows: cannot get attribute facets:%v", err)
+		return rows, err
+	}
+	return rows, nil
+}
+
+func HasCompletedOrderOf(userID, productID uuid.UUID) (bool, error) {
+	SQL := `SELECT EXISTS(SELECT 1
+                          FROM   order_details
+                          JOIN   user_cart_products ON user_cart_products.id = ANY(order_details.cart_id)
+                          WHERE  order_details.user_id = $1
+                          AND    order_details.status = 'completed'
+                          AND    user_cart_products.product_id = $2)`
+	var purchased bool
+	err := database.AudiophileDB.Get(&purchased, SQL, userID, productID)
+	if err != nil {
+		logrus.Printf("HasCompletedOrderOf: cannot check orders:%v", err)
+		return false, err
+	}
+	return purchased, nil
+}
+
+// RateProduct stores the user's rating of a product, rating it again replaces the earlier one
+func RateProduct(userID, productID uuid.UUID, rating int) error {
+	SQL := `INSERT INTO product_ratings(product_id, user_id, rating)
+            VALUES      ($1, $2, $3)
+            ON CONFLICT (product_id, user_id) DO UPDATE
+            SET         rating = EXCLUDED.rating,
+                        updated_at = now()`
+	_, err := database.AudiophileDB.Exec(SQL, productID, userID, rating)
+	if err != nil {
+		logrus.Printf("RateProduct: cannot rate product:%v", err)
+		return err
+	}
+	return nil
+}
+
+// likePrefix escapes the wildcards of user input that is used as the prefix of an ilike pattern
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix)
+}
+
+// GetSuggestions finds the names starting with prefix, or with a word starting with it, names that
+// start with the prefix come first
+func GetSuggestions(prefix string, limit int) (models.Suggestions, error) {
+	suggestions := models.Suggestions{
+		Products:   make([]models.ProductSuggestion, 0),
+		Brands:     make([]models.BrandSuggestion, 0),
+		Categories: make([]models.CategorySuggestion, 0),
+	}
+	pattern := likePrefix(prefix)
+
+	SQL := `SELECT   id,
+                     name
+            FROM     inventory
+            WHERE    archived_at IS NULL
+            AND      (name ILIKE $1 || '%' OR name ILIKE '% ' || $1 || '%')
+            ORDER BY name ILIKE $1 || '%' DESC, word_similarity($2, name) DESC, name, id
+            LIMIT    $3`
+
+	err := database.AudiophileDB.Select(&suggestions.Products, SQL, pattern, prefix, limit)
+	if err != nil {
+		logrus.Printf("GetSuggestions: cannot get product suggestions:%v", err)
+		return suggestions, err
+	}
+
+	SQL = `SELECT   id,
+                    brand_name as name
+           FROM     brands
+           WHERE    archived_at IS NULL
+           AND      (brand_name ILIKE $1 || '%' OR brand_name ILIKE '% ' || $1 || '%')
+           ORDER BY brand_name ILIKE $1 || '%' DESC, word_similarity($2, brand_name) DESC, brand_name, id
+           LIMIT    $3`
+
+	err = database.AudiophileDB.Select(&suggestions.Brands, SQL, pattern, prefix, limit)
+	if err != nil {
+		logrus.Printf("GetSuggestions: cannot get brand suggestions:%v", err)
+		return suggestions, err
+	}
+
+	SQL = `SELECT   id,
+                    name
+           FROM     category
+           WHERE    archived_at IS NULL
+           AND      (name ILIKE $1 || '%' OR name ILIKE '% ' || $1 || '%')
+           ORDER BY name ILIKE $1 || '%' DESC, word_similarity($2, name) DESC, name, id
+           LIMIT    $3`
+
+	err = database.AudiophileDB.Select(&suggestions.Categories, SQL, pattern, prefix, limit)
+	if err != nil {
+		logrus.Printf("GetSuggestions: cannot get category suggestions:%v", err)
+		return suggestions, err
+	}
+	return suggestions, nil
+}
+
+func CountProducts(filterCheck models.FiltersCheck) (int, error) {
+	psql := sqrl.StatementBuilder.PlaceholderFormat(sqrl.Dollar)
+	SQL, args, err := psql.Select("count(*)").
+		From("inventory").
+		Where(catalogWhere(filterCheck)).
+		ToSql()
+	if err != nil {
+		logrus.Printf("CountProducts: not able to create sql string: %v", err)
+		return 0, err
+	}
+
+	var count int
+	err = database.AudiophileDB.Get(&count, SQL, args...)
+	if err != nil {
+		logrus.Printf("CountProducts: cannot count products:%v", err)
+		return count, err
+	}
+	return count, nil
+}
@@ -0,0 +1,171 @@
+package helper
+
+import (
+	"Audiophile/database"
+	"Audiophile/models"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+func FetchCategory(categoryID uuid.UUID) (models.CategoryNode, error) {
+	SQL := `SELECT  id,
+                    parent_id,
+                    name
+            FROM    category
+            WHERE   id = $1
+            AND     archived_at IS NULL`
+	var category models.CategoryNode
+	err := database.AudiophileDB.Get(&category, SQL, categoryID)
+	if err != nil {
+		logrus.Printf("FetchCategory: cannot get category:%v", err)
+		return category, err
+	}
+	return category, nil
+}
+
+func RenameCategory(categoryID uuid.UUID, name string) (bool, error) {
+	SQL := `UPDATE  category
+            SET     name = $2,
+                    updated_at = now()
+            WHERE   id = $1
+            AND     archived_at IS NULL`
+	result, err := database.AudiophileDB.Exec(SQL, categoryID, name)
+	if err != nil {
+		logrus.Printf("RenameCategory: cannot rename category:%v", err)
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// MoveCategory puts the category under parentID, it refuses archived parents, parents inside the
+// category's own subtree which would make the tree a cycle and parents that define an attribute key
+// the subtree already defines, its products would otherwise see the same key twice
+func MoveCategory(categoryID uuid.UUID, parentID *uuid.UUID, tx *sqlx.Tx) (bool, error) {
+	// two concurrent moves could each pass the cycle check and still close a loop together, the same
+	// goes for a move and a new attribute definition with a key the other side already has
+	_, err := tx.Exec(`LOCK TABLE category, attribute_definitions IN SHARE ROW EXCLUSIVE MODE`)
+	if err != nil {
+		logrus.Printf("MoveCategory: cannot lock categories:%v", err)
+		return false, err
+	}
+
+	SQL := `WITH RECURSIVE subtree AS (
+                SELECT id FROM category WHERE id = $1
+                UNION
+                SELECT category.id
+                FROM   category
+                JOIN   subtree ON category.parent_id = subtree.id
+            ), new_ancestors AS (
+                SELECT id, parent_id FROM category WHERE id = $2
+                UNION
+                SELECT category.id, category.parent_id
+                FROM   category
+                JOIN   new_ancestors ON category.id = new_ancestors.parent_id
+            )
+            UPDATE  category
+            SET     parent_id = $2,
+                    updated_at = now()
+            WHERE   id = $1
+            AND     archived_at IS NULL
+            AND     ($2::uuid IS NULL OR (
+                        EXISTS(SELECT 1 FROM category WHERE id = $2 AND archived_at IS NULL)
+                        AND $2 NOT IN (SELECT id FROM subtree)
+                        AND NOT EXISTS(SELECT 1
+                                       FROM   attribute_definitions below
+                                       JOIN   attribute_definitions above ON above.key = below.key
+                                       WHERE  below.category_id IN (SELECT id FROM subtree)
+                                       AND    above.category_id IN (SELECT id FROM new_ancestors)
+                                       AND    below.archived_at IS NULL
+                                       AND    above.archived_at IS NULL)))`
+	result, err := tx.Exec(SQL, categoryID, parentID)
+	if err != nil {
+		logrus.Printf("MoveCategory: cannot move category:%v", err)
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// ArchiveCategory only archives empty categories, ones without products or subcategories left
+func ArchiveCategory(categoryID uuid.UUID) (bool, error) {
+	SQL := `UPDATE  category
+            SET     archived_at = now()
+            WHERE   id = $1
+            AND     archived_at IS NULL
+            AND     NOT EXISTS(SELECT 1 FROM category children WHERE children.parent_id = $1 AND children.archived_at IS NULL)
+            AND     NOT EXISTS(SELECT 1 FROM inventory WHERE category_id = $1 AND inventory.archived_at IS NULL)`
+	result, err := database.AudiophileDB.Exec(SQL, categoryID)
+	if err != nil {
+		logrus.Printf("ArchiveCategory: cannot archive category:%v", err)
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// GetCategoryTree returns the top level categories with their subcategories nested below them
+func GetCategoryTree() ([]*models.CategoryNode, error) {
+	SQL := `SELECT   category.id,
+                     category.parent_id,
+                     category.name,
+                     count(inventory.id) as product_count
+            FROM     category
+            LEFT JOIN inventory ON inventory.category_id = category.id AND inventory.archived_at IS NULL
+            WHERE    category.archived_at IS NULL
+            GROUP BY category.id
+            ORDER BY category.name, category.id`
+
+	categories := make([]*models.CategoryNode, 0)
+	err := database.AudiophileDB.Select(&categories, SQL)
+	if err != nil {
+		logrus.Printf("GetCategoryTree: cannot get categories:%v", err)
+		return nil, err
+	}
+
+	byID := make(map[uuid.UUID]*models.CategoryNode, len(categories))
+	for _, category := range categories {
+		category.Children = make([]*models.CategoryNode, 0)
+		byID[category.ID] = category
+	}
+
+	roots := make([]*models.CategoryNode, 0)
+	for _, category := range categories {
+		parent, ok := byID[uuidValue(category.ParentID)]
+		if category.ParentID == nil || !ok {
+			roots = append(roots, category)
+			continue
+		}
+		parent.Children = append(parent.Children, category)
+	}
+
+	for _, root := range roots {
+		addSubtreeCounts(root)
+	}
+	return roots, nil
+}
+
+func uuidValue(id *uuid.UUID) uuid.UUID {
+	if id == nil {
+		return uuid.Nil
+	}
+	return *id
+}
+
+// addSubtreeCounts adds the products of the subcategories to every category's own count
+func addSubtreeCounts(category *models.CategoryNode) int {
+	for _, child := range category.Children {
+		category.ProductCount += addSubtreeCounts(child)
+	}
+	return category.ProductCount
+}
@@ -0,0 +1,137 @@
+package helper
+
+import (
+	"Audiophile/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/elgris/sqrl"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// sortKey is one column of a keyset order, cast is the postgres type its cursor value is read back as
+// and args are bound to the placeholders of expr
+type sortKey struct {
+	expr string
+	args []interface{}
+	cast string
+	desc bool
+}
+
+// keysetValues selects the sort keys of a row as the json array its cursor carries
+func keysetValues(keys []sortKey) sqrl.Sqlizer {
+	exprs := make([]string, len(keys))
+	args := make([]interface{}, 0)
+	for i, key := range keys {
+		exprs[i] = key.expr
+		args = append(args, key.args...)
+	}
+	return sqrl.Expr("json_build_array("+strings.Join(exprs, ", ")+")::text as sort_keys", args...)
+}
+
+// keysetOrder is the order by clause of keys, reversed to walk backwards from a before cursor, with the
+// values of its placeholders
+func keysetOrder(keys []sortKey, reverse bool) (string, []interface{}) {
+	clauses := make([]string, len(keys))
+	args := make([]interface{}, 0)
+	for i, key := range keys {
+		clauses[i] = key.expr
+		if key.desc != reverse {
+			clauses[i] += " DESC"
+		}
+		args = append(args, key.args...)
+	}
+	return strings.Join(clauses, ", "), args
+}
+
+// keysetWhere keeps the rows that come after the cursor in the order of keys, cursor is the json array
+// of its values
+func keysetWhere(keys []sortKey, cursor string, reverse bool) sqrl.Sqlizer {
+	value := func(i int) string {
+		return fmt.Sprintf("(?::json->>%d)::%s", i, keys[i].cast)
+	}
+
+	alternatives := make([]string, len(keys))
+	args := make([]interface{}, 0)
+	for i, key := range keys {
+		terms := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			terms = append(terms, keys[j].expr+" = "+value(j))
+			args = append(append(args, keys[j].args...), cursor)
+		}
+		operator := " > "
+		if key.desc != reverse {
+			operator = " < "
+		}
+		terms = append(terms, key.expr+operator+value(i))
+		args = append(append(args, key.args...), cursor)
+		alternatives[i] = "(" + strings.Join(terms, " AND ") + ")"
+	}
+	return sqrl.Expr("("+strings.Join(alternatives, " OR ")+")", args...)
+}
+
+// cursorValues checks a client supplied cursor against the keys and returns the json array of its
+// values for keysetWhere, it is empty without a cursor
+func cursorValues(keys []sortKey, cursor *models.Cursor) (string, error) {
+	if cursor == nil {
+		return "", nil
+	}
+
+	var values []interface{}
+	err := json.Unmarshal(cursor.Values, &values)
+	if err != nil || len(values) != len(keys) {
+		return "", ErrInvalidCursor
+	}
+	for i, key := range keys {
+		var valid bool
+		switch key.cast {
+		case "float8":
+			_, valid = values[i].(float64)
+		case "text":
+			_, valid = values[i].(string)
+		case "uuid":
+			var text string
+			text, valid = values[i].(string)
+			if valid {
+				_, err = uuid.Parse(text)
+				valid = err == nil
+			}
+		case "timestamptz":
+			var text string
+			text, valid = values[i].(string)
+			if valid {
+				_, err = time.Parse(time.RFC3339, text)
+				valid = err == nil
+			}
+		}
+		if !valid {
+			return "", ErrInvalidCursor
+		}
+	}
+	return string(cursor.Values), nil
+}
+
+// pageCursors returns the cursors of the pages around the one between the sort keys of its first and
+// last row, hasMore tells whether rows were left over in the direction the page was read in
+func pageCursors(sort string, cursor *models.Cursor, page int, hasMore bool, first, last string) (prev, next string) {
+	if first == "" {
+		return "", ""
+	}
+	hasPrev := cursor != nil || page > 0
+	hasNext := hasMore
+	if cursor != nil && cursor.Before {
+		hasPrev, hasNext = hasMore, true
+	}
+
+	if hasPrev {
+		prev = models.Cursor{Sort: sort, Values: json.RawMessage(first), Before: true}.Encode()
+	}
+	if hasNext {
+		next = models.Cursor{Sort: sort, Values: json.RawMessage(last)}.Encode()
+	}
+	return prev, next
+}
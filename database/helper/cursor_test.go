@@ -0,0 +1,191 @@
+package helper
+
+import (
+	"Audiophile/models"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+var testSortKeys = []sortKey{
+	{expr: "inventory.price", cast: "float8", desc: true},
+	{expr: "inventory.name", cast: "text"},
+	{expr: "inventory.created_at", cast: "timestamptz"},
+	{expr: "inventory.id", cast: "uuid"},
+}
+
+func TestCursorValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		values string
+		valid  bool
+	}{
+		{name: "valid", values: `[12.5, "Amp", "2022-09-01T10:00:00Z", "6f1c5c9e-1f0e-4c53-9d1f-3c3c1b2f7a10"]`, valid: true},
+		{name: "timestamp with offset", values: `[0, "", "2022-09-01T10:00:00+05:30", "6f1c5c9e-1f0e-4c53-9d1f-3c3c1b2f7a10"]`, valid: true},
+		{name: "too few values", values: `[12.5, "Amp", "2022-09-01T10:00:00Z"]`, valid: false},
+		{name: "too many values", values: `[12.5, "Amp", "2022-09-01T10:00:00Z", "6f1c5c9e-1f0e-4c53-9d1f-3c3c1b2f7a10", 1]`, valid: false},
+		{name: "number as text", values: `["12.5", "Amp", "2022-09-01T10:00:00Z", "6f1c5c9e-1f0e-4c53-9d1f-3c3c1b2f7a10"]`, valid: false},
+		{name: "text as number", values: `[12.5, 3, "2022-09-01T10:00:00Z", "6f1c5c9e-1f0e-4c53-9d1f-3c3c1b2f7a10"]`, valid: false},
+		{name: "invalid timestamp", values: `[12.5, "Amp", "yesterday", "6f1c5c9e-1f0e-4c53-9d1f-3c3c1b2f7a10"]`, valid: false},
+		{name: "invalid uuid", values: `[12.5, "Amp", "2022-09-01T10:00:00Z", "1' OR '1'='1"]`, valid: false},
+		{name: "null value", values: `[null, "Amp", "2022-09-01T10:00:00Z", "6f1c5c9e-1f0e-4c53-9d1f-3c3c1b2f7a10"]`, valid: false},
+		{name: "object instead of array", values: `{"price": 12.5}`, valid: false},
+		{name: "not json", values: `[12.5,`, valid: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cursor := &models.Cursor{Sort: models.SortPriceDesc, Values: json.RawMessage(test.values)}
+			values, err := cursorValues(testSortKeys, cursor)
+			if test.valid {
+				if err != nil {
+					t.Fatalf("cursorValues error = %v", err)
+				}
+				if values != test.values {
+					t.Errorf("cursorValues = %s, want %s", values, test.values)
+				}
+				return
+			}
+			if err != ErrInvalidCursor {
+				t.Errorf("cursorValues error = %v, want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
+
+func TestCursorValuesWithoutCursor(t *testing.T) {
+	values, err := cursorValues(testSortKeys, nil)
+	if err != nil || values != "" {
+		t.Errorf("cursorValues(nil) = %q, %v, want no values", values, err)
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	sortKeys := `[12.5,"Amp \"Pro\"","2022-09-01T10:00:00Z","6f1c5c9e-1f0e-4c53-9d1f-3c3c1b2f7a10"]`
+	for _, before := range []bool{false, true} {
+		encoded := models.Cursor{Sort: models.SortPriceDesc, Values: json.RawMessage(sortKeys), Before: before}.Encode()
+		if strings.ContainsAny(encoded, "+/=") {
+			t.Errorf("encoded cursor %s is not url safe", encoded)
+		}
+
+		cursor, err := models.DecodeCursor(encoded)
+		if err != nil {
+			t.Fatalf("DecodeCursor: %v", err)
+		}
+		if cursor.Sort != models.SortPriceDesc || cursor.Before != before {
+			t.Errorf("DecodeCursor = %+v, want sort %s and before %v", cursor, models.SortPriceDesc, before)
+		}
+		values, err := cursorValues(testSortKeys, &cursor)
+		if err != nil {
+			t.Fatalf("cursorValues: %v", err)
+		}
+		if values != sortKeys {
+			t.Errorf("cursorValues = %s, want %s", values, sortKeys)
+		}
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	for _, encoded := range []string{"%%%", "bm90IGpzb24", models.Cursor{}.Encode()[:3]} {
+		if _, err := models.DecodeCursor(encoded); err == nil {
+			t.Errorf("DecodeCursor(%q) succeeded, want an error", encoded)
+		}
+	}
+}
+
+func TestKeysetWhere(t *testing.T) {
+	keys := []sortKey{
+		{expr: "rank(?)", args: []interface{}{"amp"}, cast: "float8", desc: true},
+		{expr: "inventory.id", cast: "uuid"},
+	}
+	tests := []struct {
+		reverse bool
+		sql     string
+	}{
+		{
+			reverse: false,
+			sql:     "((rank(?) < (?::json->>0)::float8) OR (rank(?) = (?::json->>0)::float8 AND inventory.id > (?::json->>1)::uuid))",
+		},
+		{
+			reverse: true,
+			sql:     "((rank(?) > (?::json->>0)::float8) OR (rank(?) = (?::json->>0)::float8 AND inventory.id < (?::json->>1)::uuid))",
+		},
+	}
+	for _, test := range tests {
+		sql, args, err := keysetWhere(keys, "[1,\"x\"]", test.reverse).ToSql()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sql != test.sql {
+			t.Errorf("keysetWhere(reverse %v) = %s, want %s", test.reverse, sql, test.sql)
+		}
+		want := []interface{}{"amp", "[1,\"x\"]", "amp", "[1,\"x\"]", "[1,\"x\"]"}
+		if len(args) != len(want) {
+			t.Fatalf("keysetWhere args = %v, want %v", args, want)
+		}
+		for i := range want {
+			if args[i] != want[i] {
+				t.Errorf("keysetWhere args = %v, want %v", args, want)
+				break
+			}
+		}
+	}
+}
+
+func TestKeysetOrder(t *testing.T) {
+	keys := []sortKey{
+		{expr: "rank(?)", args: []interface{}{"amp"}, cast: "float8", desc: true},
+		{expr: "inventory.id", cast: "uuid"},
+	}
+	order, args := keysetOrder(keys, false)
+	if order != "rank(?) DESC, inventory.id" || len(args) != 1 || args[0] != "amp" {
+		t.Errorf("keysetOrder = %s %v", order, args)
+	}
+	order, _ = keysetOrder(keys, true)
+	if order != "rank(?), inventory.id DESC" {
+		t.Errorf("reversed keysetOrder = %s", order)
+	}
+}
+
+func TestPageCursors(t *testing.T) {
+	first, last := `[1]`, `[2]`
+	after := &models.Cursor{Sort: models.SortName, Values: json.RawMessage(`[0]`)}
+	before := &models.Cursor{Sort: models.SortName, Values: json.RawMessage(`[3]`), Before: true}
+	tests := []struct {
+		name     string
+		cursor   *models.Cursor
+		page     int
+		hasMore  bool
+		wantPrev bool
+		wantNext bool
+	}{
+		{name: "first page", wantPrev: false, wantNext: false},
+		{name: "first page with more", hasMore: true, wantPrev: false, wantNext: true},
+		{name: "offset page", page: 2, hasMore: true, wantPrev: true, wantNext: true},
+		{name: "after a cursor", cursor: after, wantPrev: true, wantNext: false},
+		{name: "before a cursor", cursor: before, wantPrev: false, wantNext: true},
+		{name: "before a cursor with more", cursor: before, hasMore: true, wantPrev: true, wantNext: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prev, next := pageCursors(models.SortName, test.cursor, test.page, test.hasMore, first, last)
+			if (prev != "") != test.wantPrev || (next != "") != test.wantNext {
+				t.Fatalf("pageCursors = %q, %q, want prev %v and next %v", prev, next, test.wantPrev, test.wantNext)
+			}
+			if prev != "" {
+				cursor, err := models.DecodeCursor(prev)
+				if err != nil || !cursor.Before || string(cursor.Values) != first {
+					t.Errorf("prev cursor = %+v, %v", cursor, err)
+				}
+			}
+			if next != "" {
+				cursor, err := models.DecodeCursor(next)
+				if err != nil || cursor.Before || string(cursor.Values) != last {
+					t.Errorf("next cursor = %+v, %v", cursor, err)
+				}
+			}
+		})
+	}
+	if prev, next := pageCursors(models.SortName, nil, 1, true, "", ""); prev != "" || next != "" {
+		t.Errorf("empty page cursors = %q, %q", prev, next)
+	}
+}
@@ -0,0 +1,100 @@
+package helper
+
+import (
+	"Audiophile/database"
+	"Audiophile/models"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+func FetchIdentityUser(provider, subject string) (uuid.UUID, error) {
+	SQL := `SELECT user_identities.user_id
+            FROM   user_identities
+            JOIN   users ON users.id = user_identities.user_id
+            WHERE  provider=$1
+            AND    subject=$2
+            AND    users.archived_at IS NULL`
+
+	var userID uuid.UUID
+
+	err := database.AudiophileDB.Get(&userID, SQL, provider, subject)
+	if err != nil {
+		logrus.Printf("FetchIdentityUser: cannot get user for identity:%v", err)
+		return userID, err
+	}
+	return userID, nil
+}
+
+func LinkIdentity(userID uuid.UUID, externalIdentity models.ExternalIdentity, tx *sqlx.Tx) error {
+	SQL := `INSERT INTO user_identities(user_id, provider, subject, email)
+            VALUES   ($1, $2, $3, $4)`
+
+	_, err := tx.Exec(SQL, userID, externalIdentity.Provider, externalIdentity.Subject, externalIdentity.Email)
+	if err != nil {
+		logrus.Printf("LinkIdentity: cannot link identity:%v", err)
+		return err
+	}
+	return nil
+}
+
+func GetUserIdentities(userID uuid.UUID) ([]models.UserIdentity, error) {
+	SQL := `SELECT  id,
+                    provider,
+                    subject,
+                    email,
+                    created_at
+            FROM    user_identities
+            WHERE   user_id=$1
+            ORDER BY created_at`
+
+	identities := make([]models.UserIdentity, 0)
+
+	err := database.AudiophileDB.Select(&identities, SQL, userID)
+	if err != nil {
+		logrus.Printf("GetUserIdentities: cannot get identities:%v", err)
+		return identities, err
+	}
+	return identities, nil
+}
+
+// UnlinkIdentity removes a linked identity unless it is the only way left for the user to log in
+func UnlinkIdentity(userID, identityID uuid.UUID) (bool, error) {
+	SQL := `DELETE FROM user_identities
+            WHERE  id=$1
+            AND    user_id=$2
+            AND    (EXISTS (SELECT 1 FROM users WHERE users.id=$2 AND password <> '')
+                    OR (SELECT count(*) FROM user_identities WHERE user_id=$2) > 1)`
+
+	result, err := database.AudiophileDB.Exec(SQL, identityID, userID)
+	if err != nil {
+		logrus.Printf("UnlinkIdentity: cannot unlink identity:%v", err)
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		logrus.Printf("UnlinkIdentity: cannot get affected rows:%v", err)
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// FetchPasswordlessUserID finds an account that was created through an identity provider before
+// identities were linked, such an account has no password of its own
+func FetchPasswordlessUserID(email string) (uuid.UUID, error) {
+	SQL := `SELECT id
+            FROM   users
+            WHERE  email=$1
+            AND    password=''
+            AND    archived_at IS NULL
+            AND    NOT EXISTS (SELECT 1 FROM user_identities WHERE user_id=users.id)`
+
+	var userID uuid.UUID
+
+	err := database.AudiophileDB.Get(&userID, SQL, email)
+	if err != nil {
+		logrus.Printf("FetchPasswordlessUserID: cannot get user:%v", err)
+		return userID, err
+	}
+	return userID, nil
+}
@@ -0,0 +1,96 @@
+package helper
+
+import (
+	"Audiophile/database"
+	"Audiophile/models"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+func FetchLoginAttempt(kind, value string) (models.LoginAttempt, error) {
+	SQL := `SELECT  kind,
+                    value,
+                    failures,
+                    last_failed_at,
+                    locked_until
+            FROM    login_attempts
+            WHERE   kind=$1
+            AND     value=$2`
+
+	var attempt models.LoginAttempt
+
+	err := database.AudiophileDB.Get(&attempt, SQL, kind, value)
+	if err != nil {
+		logrus.Printf("FetchLoginAttempt: cannot get login attempt:%v", err)
+		return attempt, err
+	}
+	return attempt, nil
+}
+
+// RecordLoginFailure bumps the failure counter and returns it, failures older than window are forgotten
+func RecordLoginFailure(kind, value string, window time.Duration) (int, error) {
+	SQL := `INSERT INTO login_attempts(kind, value, failures, last_failed_at)
+            VALUES   ($1, $2, 1, now())
+            ON CONFLICT (kind, value) DO UPDATE
+            SET      failures = CASE WHEN login_attempts.last_failed_at < now() - make_interval(secs => $3)
+                                     THEN 1
+                                     ELSE login_attempts.failures + 1
+                                END,
+                     last_failed_at = now()
+            RETURNING failures`
+
+	var failures int
+
+	err := database.AudiophileDB.Get(&failures, SQL, kind, value, window.Seconds())
+	if err != nil {
+		logrus.Printf("RecordLoginFailure: cannot record failure:%v", err)
+		return failures, err
+	}
+	return failures, nil
+}
+
+func LockLogin(kind, value string, until time.Time) error {
+	SQL := `UPDATE  login_attempts
+            SET     locked_until=$3
+            WHERE   kind=$1
+            AND     value=$2`
+
+	_, err := database.AudiophileDB.Exec(SQL, kind, value, until)
+	if err != nil {
+		logrus.Printf("LockLogin: cannot lock login:%v", err)
+		return err
+	}
+	return nil
+}
+
+func ClearLoginAttempts(kind, value string) error {
+	SQL := `DELETE FROM login_attempts
+            WHERE  kind=$1
+            AND    value=$2`
+
+	_, err := database.AudiophileDB.Exec(SQL, kind, value)
+	if err != nil {
+		logrus.Printf("ClearLoginAttempts: cannot clear login attempts:%v", err)
+		return err
+	}
+	return nil
+}
+
+func GetLoginAttempts() ([]models.LoginAttempt, error) {
+	SQL := `SELECT  kind,
+                    value,
+                    failures,
+                    last_failed_at,
+                    locked_until
+            FROM    login_attempts
+            ORDER BY locked_until DESC NULLS LAST, last_failed_at DESC`
+
+	attempts := make([]models.LoginAttempt, 0)
+
+	err := database.AudiophileDB.Select(&attempts, SQL)
+	if err != nil {
+		logrus.Printf("GetLoginAttempts: cannot get login attempts:%v", err)
+		return attempts, err
+	}
+	return attempts, nil
+}
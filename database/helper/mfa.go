@@ -0,0 +1,249 @@
+package helper
+
+import (
+	"Audiophile/database"
+	"Audiophile/models"
+	"database/sql"
+	"github.com/elgris/sqrl"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+func FetchEmail(userID uuid.UUID) (string, error) {
+	SQL := `SELECT email
+            FROM   users
+            WHERE  id=$1
+            AND    archived_at IS NULL`
+
+	var email string
+
+	err := database.AudiophileDB.Get(&email, SQL, userID)
+	if err != nil {
+		logrus.Printf("FetchEmail: cannot get email:%v", err)
+		return email, err
+	}
+	return email, nil
+}
+
+// FetchTOTP returns the TOTP enrollment of a user, users that never enrolled get an empty, disabled one
+func FetchTOTP(userID uuid.UUID) (models.TOTPDetails, error) {
+	SQL := `SELECT  secret,
+                    enabled_at IS NOT NULL as enabled,
+                    COALESCE(last_used_step, 0) as last_used_step
+            FROM    user_totp
+            WHERE   user_id=$1`
+
+	var totpDetails models.TOTPDetails
+
+	err := database.AudiophileDB.Get(&totpDetails, SQL, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return totpDetails, nil
+		}
+		logrus.Printf("FetchTOTP: cannot get totp details:%v", err)
+		return totpDetails, err
+	}
+	return totpDetails, nil
+}
+
+// SavePendingTOTP stores a new secret that only becomes active once a code generated from it is confirmed
+func SavePendingTOTP(userID uuid.UUID, secret string) error {
+	SQL := `INSERT INTO user_totp(user_id, secret)
+            VALUES   ($1, $2)
+            ON CONFLICT (user_id) DO UPDATE
+            SET      secret=excluded.secret,
+                     last_used_step=NULL,
+                     updated_at=now()
+            WHERE    user_totp.enabled_at IS NULL`
+
+	_, err := database.AudiophileDB.Exec(SQL, userID, secret)
+	if err != nil {
+		logrus.Printf("SavePendingTOTP: cannot save totp secret:%v", err)
+		return err
+	}
+	return nil
+}
+
+func EnableTOTP(userID uuid.UUID, step int64, tx *sqlx.Tx) error {
+	SQL := `UPDATE  user_totp
+            SET     enabled_at=now(),
+                    last_used_step=$2,
+                    updated_at=now()
+            WHERE   user_id=$1`
+
+	_, err := tx.Exec(SQL, userID, step)
+	if err != nil {
+		logrus.Printf("EnableTOTP: cannot enable totp:%v", err)
+		return err
+	}
+	return nil
+}
+
+// UseTOTPStep records the step of an accepted code and reports false when that step, or a later one,
+// was already used by a concurrent request
+func UseTOTPStep(userID uuid.UUID, step int64) (bool, error) {
+	SQL := `UPDATE  user_totp
+            SET     last_used_step=$2,
+                    updated_at=now()
+            WHERE   user_id=$1
+            AND     COALESCE(last_used_step, 0) < $2`
+
+	result, err := database.AudiophileDB.Exec(SQL, userID, step)
+	if err != nil {
+		logrus.Printf("UseTOTPStep: cannot update totp step:%v", err)
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		logrus.Printf("UseTOTPStep: cannot get affected rows:%v", err)
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+func DeleteTOTP(userID uuid.UUID, tx *sqlx.Tx) error {
+	SQL := `DELETE FROM user_totp
+            WHERE  user_id=$1`
+
+	_, err := tx.Exec(SQL, userID)
+	if err != nil {
+		logrus.Printf("DeleteTOTP: cannot delete totp:%v", err)
+		return err
+	}
+	return DeleteRecoveryCodes(userID, tx)
+}
+
+func DeleteRecoveryCodes(userID uuid.UUID, tx *sqlx.Tx) error {
+	SQL := `DELETE FROM mfa_recovery_codes
+            WHERE  user_id=$1`
+
+	_, err := tx.Exec(SQL, userID)
+	if err != nil {
+		logrus.Printf("DeleteRecoveryCodes: cannot delete recovery codes:%v", err)
+		return err
+	}
+	return nil
+}
+
+func AddRecoveryCodes(userID uuid.UUID, codeHashes []string, tx *sqlx.Tx) error {
+	psql := sqrl.StatementBuilder.PlaceholderFormat(sqrl.Dollar)
+	insert := psql.Insert("mfa_recovery_codes").Columns("user_id", "code_hash")
+	for _, codeHash := range codeHashes {
+		insert.Values(userID, codeHash)
+	}
+
+	SQL, args, err := insert.ToSql()
+	if err != nil {
+		logrus.Printf("AddRecoveryCodes: not able to create sql string: %v", err)
+		return err
+	}
+
+	_, err = tx.Exec(SQL, args...)
+	if err != nil {
+		logrus.Printf("AddRecoveryCodes: cannot add recovery codes:%v", err)
+		return err
+	}
+	return nil
+}
+
+// UseRecoveryCode burns a matching unused recovery code and reports whether one was found
+func UseRecoveryCode(userID uuid.UUID, codeHash string) (bool, error) {
+	SQL := `UPDATE  mfa_recovery_codes
+            SET     used_at=now()
+            WHERE   id = (SELECT id
+                          FROM   mfa_recovery_codes
+                          WHERE  user_id=$1
+                          AND    code_hash=$2
+                          AND    used_at IS NULL
+                          LIMIT  1)`
+
+	result, err := database.AudiophileDB.Exec(SQL, userID, codeHash)
+	if err != nil {
+		logrus.Printf("UseRecoveryCode: cannot use recovery code:%v", err)
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		logrus.Printf("UseRecoveryCode: cannot get affected rows:%v", err)
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+func SetMFAPolicy(policy models.MFAPolicy) error {
+	SQL := `INSERT INTO role_mfa_policies(role, mfa_required)
+            VALUES   ($1, $2)
+            ON CONFLICT (role) DO UPDATE
+            SET      mfa_required=excluded.mfa_required,
+                     updated_at=now()`
+
+	_, err := database.AudiophileDB.Exec(SQL, policy.Role, policy.Required)
+	if err != nil {
+		logrus.Printf("SetMFAPolicy: cannot set mfa policy:%v", err)
+		return err
+	}
+	return nil
+}
+
+// CreateMFAChallenge starts the second step of a login, its id is carried by the mfa pending token
+func CreateMFAChallenge(userID uuid.UUID, expiresAt time.Time) (uuid.UUID, error) {
+	SQL := `INSERT INTO mfa_challenges(user_id, expires_at)
+            VALUES   ($1, $2)
+            RETURNING id`
+
+	var challengeID uuid.UUID
+
+	err := database.AudiophileDB.Get(&challengeID, SQL, userID, expiresAt)
+	if err != nil {
+		logrus.Printf("CreateMFAChallenge: cannot create challenge:%v", err)
+		return challengeID, err
+	}
+	return challengeID, nil
+}
+
+// UseMFAChallengeAttempt counts an attempt against a challenge of the user before the code is checked,
+// it returns false when the challenge is expired, already used or out of attempts
+func UseMFAChallengeAttempt(challengeID, userID uuid.UUID, maxAttempts int) (bool, error) {
+	SQL := `UPDATE  mfa_challenges
+            SET     attempts=attempts + 1
+            WHERE   id=$1
+            AND     user_id=$2
+            AND     used_at IS NULL
+            AND     expires_at > now()
+            AND     attempts < $3`
+
+	result, err := database.AudiophileDB.Exec(SQL, challengeID, userID, maxAttempts)
+	if err != nil {
+		logrus.Printf("UseMFAChallengeAttempt: cannot count attempt:%v", err)
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		logrus.Printf("UseMFAChallengeAttempt: cannot get affected rows:%v", err)
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// CompleteMFAChallenge burns a challenge once its code was right so that the token cannot be used for a
+// second session, it returns false when another request completed it first
+func CompleteMFAChallenge(challengeID uuid.UUID) (bool, error) {
+	SQL := `UPDATE  mfa_challenges
+            SET     used_at=now()
+            WHERE   id=$1
+            AND     used_at IS NULL`
+
+	result, err := database.AudiophileDB.Exec(SQL, challengeID)
+	if err != nil {
+		logrus.Printf("CompleteMFAChallenge: cannot complete challenge:%v", err)
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		logrus.Printf("CompleteMFAChallenge: cannot get affected rows:%v", err)
+		return false, err
+	}
+	return rows == 1, nil
+}
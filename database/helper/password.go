@@ -0,0 +1,93 @@
+package helper
+
+import (
+	"Audiophile/database"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"time"
+)
+
+func FetchUserIDByEmail(email string) (uuid.UUID, error) {
+	SQL := `SELECT id
+            FROM   users
+            WHERE  email = $1
+            AND    archived_at IS NULL`
+
+	var userID uuid.UUID
+
+	err := database.AudiophileDB.Get(&userID, SQL, email)
+	if err != nil {
+		logrus.Printf("FetchUserIDByEmail: cannot get userID from email:%v", err)
+		return userID, err
+	}
+	return userID, nil
+}
+
+func CreatePasswordResetToken(userID uuid.UUID, tokenHash string, expiresAt time.Time) error {
+	SQL := `INSERT INTO password_reset_tokens(user_id, token_hash, expires_at)
+            VALUES   ($1, $2, $3)`
+
+	_, err := database.AudiophileDB.Exec(SQL, userID, tokenHash, expiresAt)
+	if err != nil {
+		logrus.Printf("CreatePasswordResetToken: cannot create reset token:%v", err)
+		return err
+	}
+	return nil
+}
+
+// ConsumePasswordResetToken marks an unused, unexpired reset token as used and returns its user,
+// it returns sql.ErrNoRows for unknown, expired or already used tokens
+func ConsumePasswordResetToken(tokenHash string, tx *sqlx.Tx) (uuid.UUID, error) {
+	SQL := `UPDATE  password_reset_tokens
+            SET     used_at=now()
+            WHERE   token_hash=$1
+            AND     used_at IS NULL
+            AND     expires_at > now()
+            RETURNING user_id`
+
+	var userID uuid.UUID
+
+	err := tx.Get(&userID, SQL, tokenHash)
+	if err != nil {
+		logrus.Printf("ConsumePasswordResetToken: cannot use reset token:%v", err)
+		return userID, err
+	}
+	return userID, nil
+}
+
+// ExpirePasswordResetTokens invalidates every outstanding reset token of a user
+func ExpirePasswordResetTokens(userID uuid.UUID, tx *sqlx.Tx) error {
+	SQL := `UPDATE  password_reset_tokens
+            SET     used_at=now()
+            WHERE   user_id=$1
+            AND     used_at IS NULL`
+
+	_, err := tx.Exec(SQL, userID)
+	if err != nil {
+		logrus.Printf("ExpirePasswordResetTokens: cannot expire reset tokens:%v", err)
+		return err
+	}
+	return nil
+}
+
+func UpdatePassword(userID uuid.UUID, password string, tx *sqlx.Tx) error {
+	hashPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		logrus.Printf("UpdatePassword: Not able to hash password:%v", err)
+		return err
+	}
+
+	SQL := `UPDATE  users
+            SET     password=$1,
+                    updated_at=now()
+            WHERE   id=$2`
+
+	_, err = tx.Exec(SQL, hashPassword, userID)
+	if err != nil {
+		logrus.Printf("UpdatePassword: cannot update password:%v", err)
+		return err
+	}
+	return nil
+}
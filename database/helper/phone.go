@@ -0,0 +1,126 @@
+package helper
+
+import (
+	"Audiophile/database"
+	"Audiophile/models"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+func FetchPhoneStatus(userID uuid.UUID) (models.PhoneStatus, error) {
+	SQL := `SELECT  phone_no,
+                    phone_verified_at IS NOT NULL as verified
+            FROM    users
+            WHERE   id=$1
+            AND     archived_at IS NULL`
+
+	var status models.PhoneStatus
+
+	err := database.AudiophileDB.Get(&status, SQL, userID)
+	if err != nil {
+		logrus.Printf("FetchPhoneStatus: cannot get phone status:%v", err)
+		return status, err
+	}
+	return status, nil
+}
+
+// FetchOTPSendStats tells when the last code was sent to a user and how many were sent within window
+func FetchOTPSendStats(userID uuid.UUID, window time.Duration) (models.OTPSendStats, error) {
+	SQL := `SELECT  max(created_at) as last_sent_at,
+                    count(*) FILTER (WHERE created_at > now() - make_interval(secs => $2)) as sent_in_window
+            FROM    phone_otps
+            WHERE   user_id=$1`
+
+	var stats models.OTPSendStats
+
+	err := database.AudiophileDB.Get(&stats, SQL, userID, window.Seconds())
+	if err != nil {
+		logrus.Printf("FetchOTPSendStats: cannot get otp stats:%v", err)
+		return stats, err
+	}
+	return stats, nil
+}
+
+// CreatePhoneOTP stores a new code for the phone number and retires the codes sent before it
+func CreatePhoneOTP(userID uuid.UUID, phoneNo, codeHash string, expiresAt time.Time, tx *sqlx.Tx) error {
+	SQL := `UPDATE  phone_otps
+            SET     used_at=now()
+            WHERE   user_id=$1
+            AND     used_at IS NULL`
+
+	_, err := tx.Exec(SQL, userID)
+	if err != nil {
+		logrus.Printf("CreatePhoneOTP: cannot expire old codes:%v", err)
+		return err
+	}
+
+	SQL = `INSERT INTO phone_otps(user_id, phone_no, code_hash, expires_at)
+           VALUES   ($1, $2, $3, $4)`
+
+	_, err = tx.Exec(SQL, userID, phoneNo, codeHash, expiresAt)
+	if err != nil {
+		logrus.Printf("CreatePhoneOTP: cannot create code:%v", err)
+		return err
+	}
+	return nil
+}
+
+// UsePhoneOTPAttempt counts an attempt against the newest active code of a user before it is
+// compared, it returns sql.ErrNoRows when there is no active code or its attempts are used up
+func UsePhoneOTPAttempt(userID uuid.UUID, maxAttempts int) (models.PhoneOTP, error) {
+	SQL := `UPDATE  phone_otps
+            SET     attempts=attempts + 1
+            WHERE   id = (SELECT id
+                          FROM   phone_otps
+                          WHERE  user_id=$1
+                          AND    used_at IS NULL
+                          AND    expires_at > now()
+                          ORDER BY created_at DESC
+                          LIMIT  1)
+            AND     attempts < $2
+            RETURNING id, phone_no, code_hash, attempts`
+
+	var otp models.PhoneOTP
+
+	err := database.AudiophileDB.Get(&otp, SQL, userID, maxAttempts)
+	if err != nil {
+		logrus.Printf("UsePhoneOTPAttempt: no usable code:%v", err)
+		return otp, err
+	}
+	return otp, nil
+}
+
+// VerifyPhone burns the code and marks the phone as verified, as long as the account still has the
+// number the code was sent to
+func VerifyPhone(userID, otpID uuid.UUID, phoneNo string, tx *sqlx.Tx) (bool, error) {
+	SQL := `UPDATE  phone_otps
+            SET     used_at=now()
+            WHERE   id=$1`
+
+	_, err := tx.Exec(SQL, otpID)
+	if err != nil {
+		logrus.Printf("VerifyPhone: cannot use code:%v", err)
+		return false, err
+	}
+
+	SQL = `UPDATE  users
+           SET     phone_verified_at=now(),
+                   updated_at=now()
+           WHERE   id=$1
+           AND     phone_no=$2
+           AND     archived_at IS NULL`
+
+	result, err := tx.Exec(SQL, userID, phoneNo)
+	if err != nil {
+		logrus.Printf("VerifyPhone: cannot verify phone:%v", err)
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		logrus.Printf("VerifyPhone: cannot get affected rows:%v", err)
+		return false, err
+	}
+	return rows == 1, nil
+}
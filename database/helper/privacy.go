@@ -0,0 +1,185 @@
+package helper
+
+import (
+	"Audiophile/database"
+	"Audiophile/models"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+func GetExportAddresses(userID uuid.UUID) ([]models.ExportAddress, error) {
+	SQL := `SELECT  id,
+                    address,
+                    created_at,
+                    archived_at
+            FROM    user_address
+            WHERE   user_id=$1
+            ORDER BY created_at`
+
+	addresses := make([]models.ExportAddress, 0)
+
+	err := database.AudiophileDB.Select(&addresses, SQL, userID)
+	if err != nil {
+		logrus.Printf("GetExportAddresses: cannot get addresses:%v", err)
+		return addresses, err
+	}
+	return addresses, nil
+}
+
+func GetExportCarts(userID uuid.UUID) ([]models.ExportCartItem, error) {
+	SQL := `SELECT  user_cart_products.id,
+                    product_id,
+                    COALESCE(inventory.name, '') as product_name,
+                    user_cart_products.quantity,
+                    total_amount,
+                    COALESCE(order_check, false) as ordered,
+                    user_cart_products.created_at,
+                    user_cart_products.archived_at
+            FROM    user_cart_products
+            LEFT JOIN inventory ON inventory.id = user_cart_products.product_id
+            WHERE   user_id=$1
+            ORDER BY user_cart_products.created_at`
+
+	carts := make([]models.ExportCartItem, 0)
+
+	err := database.AudiophileDB.Select(&carts, SQL, userID)
+	if err != nil {
+		logrus.Printf("GetExportCarts: cannot get carts:%v", err)
+		return carts, err
+	}
+	return carts, nil
+}
+
+func GetExportOrders(userID uuid.UUID) ([]models.ExportOrder, error) {
+	SQL := `SELECT  id,
+                    address_id,
+                    total_amount,
+                    status,
+                    created_at
+            FROM    order_details
+            WHERE   user_id=$1
+            ORDER BY created_at`
+
+	orders := make([]models.ExportOrder, 0)
+
+	err := database.AudiophileDB.Select(&orders, SQL, userID)
+	if err != nil {
+		logrus.Printf("GetExportOrders: cannot get orders:%v", err)
+		return orders, err
+	}
+	return orders, nil
+}
+
+func GetExportPayments(userID uuid.UUID) ([]models.ExportPayment, error) {
+	SQL := `SELECT  id,
+                    order_id,
+                    payment_type,
+                    name,
+                    account_number
+            FROM    payment
+            WHERE   user_id=$1`
+
+	payments := make([]models.ExportPayment, 0)
+
+	err := database.AudiophileDB.Select(&payments, SQL, userID)
+	if err != nil {
+		logrus.Printf("GetExportPayments: cannot get payments:%v", err)
+		return payments, err
+	}
+	return payments, nil
+}
+
+func GetExportBills(userID uuid.UUID) ([]models.ExportBill, error) {
+	SQL := `SELECT  id,
+                    payment_id,
+                    order_id
+            FROM    bill_details
+            WHERE   user_id=$1`
+
+	bills := make([]models.ExportBill, 0)
+
+	err := database.AudiophileDB.Select(&bills, SQL, userID)
+	if err != nil {
+		logrus.Printf("GetExportBills: cannot get bills:%v", err)
+		return bills, err
+	}
+	return bills, nil
+}
+
+// AnonymiseUser scrubs the personal data of an account and archives it, order_details and
+// bill_details are left untouched for accounting and keep pointing at the anonymised row
+func AnonymiseUser(userID uuid.UUID, tx *sqlx.Tx) error {
+	SQL := `UPDATE  users
+            SET     name='Deleted user',
+                    email='deleted-' || id || '@deleted.invalid',
+                    phone_no='',
+                    age=NULL,
+                    password='',
+                    email_verified_at=NULL,
+                    updated_at=now(),
+                    archived_at=COALESCE(archived_at, now())
+            WHERE   id=$1`
+
+	_, err := tx.Exec(SQL, userID)
+	if err != nil {
+		logrus.Printf("AnonymiseUser: cannot anonymise user:%v", err)
+		return err
+	}
+
+	SQL = `UPDATE  user_address
+           SET     address='',
+                   updated_at=now(),
+                   archived_at=COALESCE(archived_at, now())
+           WHERE   user_id=$1`
+
+	_, err = tx.Exec(SQL, userID)
+	if err != nil {
+		logrus.Printf("AnonymiseUser: cannot anonymise addresses:%v", err)
+		return err
+	}
+
+	SQL = `UPDATE  payment
+           SET     name='',
+                   account_number=0
+           WHERE   user_id=$1`
+
+	_, err = tx.Exec(SQL, userID)
+	if err != nil {
+		logrus.Printf("AnonymiseUser: cannot anonymise payments:%v", err)
+		return err
+	}
+
+	SQL = `UPDATE  user_cart_products
+           SET     archived_at=now()
+           WHERE   user_id=$1
+           AND     archived_at IS NULL
+           AND     NOT COALESCE(order_check, false)`
+
+	_, err = tx.Exec(SQL, userID)
+	if err != nil {
+		logrus.Printf("AnonymiseUser: cannot archive carts:%v", err)
+		return err
+	}
+	return nil
+}
+
+// DeleteUserCredentials removes every way of logging into an account
+func DeleteUserCredentials(userID uuid.UUID, tx *sqlx.Tx) error {
+	statements := []string{
+		`DELETE FROM user_identities WHERE user_id=$1`,
+		`DELETE FROM user_totp WHERE user_id=$1`,
+		`DELETE FROM mfa_recovery_codes WHERE user_id=$1`,
+		`DELETE FROM mfa_challenges WHERE user_id=$1`,
+		`DELETE FROM password_reset_tokens WHERE user_id=$1`,
+		`DELETE FROM phone_otps WHERE user_id=$1`,
+	}
+	for _, SQL := range statements {
+		_, err := tx.Exec(SQL, userID)
+		if err != nil {
+			logrus.Printf("DeleteUserCredentials: cannot delete credentials:%v", err)
+			return err
+		}
+	}
+	return RevokeAllSessions(userID, tx)
+}
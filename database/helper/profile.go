@@ -0,0 +1,108 @@
+package helper
+
+import (
+	"Audiophile/database"
+	"Audiophile/models"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+func FetchProfile(userID uuid.UUID) (models.Profile, error) {
+	SQL := `SELECT  id,
+                    name,
+                    email,
+                    phone_no,
+                    COALESCE(age, 0) as age,
+                    email_verified_at IS NOT NULL as email_verified,
+                    phone_verified_at IS NOT NULL as phone_verified,
+                    created_at
+            FROM    users
+            WHERE   id=$1
+            AND     archived_at IS NULL`
+
+	var profile models.Profile
+
+	err := database.AudiophileDB.Get(&profile, SQL, userID)
+	if err != nil {
+		logrus.Printf("FetchProfile: cannot get profile:%v", err)
+		return profile, err
+	}
+	return profile, nil
+}
+
+// UpdateProfile only overwrites the fields that are set, the others are passed as NULL and kept.
+// A new phone number has to be verified again
+func UpdateProfile(userID uuid.UUID, profileUpdate models.ProfileUpdate) error {
+	SQL := `UPDATE  users
+            SET     name=COALESCE($2, name),
+                    phone_no=COALESCE($3, phone_no),
+                    phone_verified_at=CASE WHEN COALESCE($3, phone_no) = phone_no THEN phone_verified_at END,
+                    age=COALESCE($4, age),
+                    updated_at=now()
+            WHERE   id=$1
+            AND     archived_at IS NULL`
+
+	_, err := database.AudiophileDB.Exec(SQL, userID, profileUpdate.Name, profileUpdate.PhoneNo, profileUpdate.Age)
+	if err != nil {
+		logrus.Printf("UpdateProfile: cannot update profile:%v", err)
+		return err
+	}
+	return nil
+}
+
+func FetchPasswordHash(userID uuid.UUID) (string, error) {
+	SQL := `SELECT password
+            FROM   users
+            WHERE  id=$1
+            AND    archived_at IS NULL`
+
+	var password string
+
+	err := database.AudiophileDB.Get(&password, SQL, userID)
+	if err != nil {
+		logrus.Printf("FetchPasswordHash: cannot get password:%v", err)
+		return password, err
+	}
+	return password, nil
+}
+
+// RevokeOtherSessions expires every active session of a user except the one making the request
+func RevokeOtherSessions(userID, sessionID uuid.UUID, tx *sqlx.Tx) error {
+	SQL := `UPDATE sessions
+            SET    expires_at=now()
+            WHERE  user_id=$1
+            AND    id <> $2
+            AND    expires_at > now()`
+
+	_, err := tx.Exec(SQL, userID, sessionID)
+	if err != nil {
+		logrus.Printf("RevokeOtherSessions: cannot revoke sessions:%v", err)
+		return err
+	}
+	return nil
+}
+
+// ChangeEmail moves the account to a new, already verified address as long as the account still
+// has the address the change was requested from
+func ChangeEmail(userID uuid.UUID, previousEmail, email string) (bool, error) {
+	SQL := `UPDATE  users
+            SET     email=$3,
+                    email_verified_at=now(),
+                    updated_at=now()
+            WHERE   id=$1
+            AND     email=$2
+            AND     archived_at IS NULL`
+
+	result, err := database.AudiophileDB.Exec(SQL, userID, previousEmail, email)
+	if err != nil {
+		logrus.Printf("ChangeEmail: cannot change email:%v", err)
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		logrus.Printf("ChangeEmail: cannot get affected rows:%v", err)
+		return false, err
+	}
+	return rows == 1, nil
+}
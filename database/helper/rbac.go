@@ -0,0 +1,211 @@
+package helper
+
+import (
+	"Audiophile/database"
+	"Audiophile/models"
+	"github.com/elgris/sqrl"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+// FetchUserPermissions returns the union of the permissions granted by every role of a user
+func FetchUserPermissions(userID uuid.UUID) ([]string, error) {
+	SQL := `SELECT DISTINCT permission
+            FROM   roles
+            JOIN   role_permissions ON role_permissions.role = roles.role
+            WHERE  roles.user_id=$1`
+
+	permissions := make([]string, 0)
+
+	err := database.AudiophileDB.Select(&permissions, SQL, userID)
+	if err != nil {
+		logrus.Printf("FetchUserPermissions: cannot get permissions:%v", err)
+		return permissions, err
+	}
+	return permissions, nil
+}
+
+// IsMFARequiredForUser reports whether any role of the user requires two-factor authentication
+func IsMFARequiredForUser(userID uuid.UUID) (bool, error) {
+	SQL := `SELECT COALESCE(bool_or(mfa_required), false)
+            FROM   roles
+            JOIN   role_mfa_policies ON role_mfa_policies.role = roles.role
+            WHERE  roles.user_id=$1`
+
+	var required bool
+
+	err := database.AudiophileDB.Get(&required, SQL, userID)
+	if err != nil {
+		logrus.Printf("IsMFARequiredForUser: cannot get mfa policy:%v", err)
+		return false, err
+	}
+	return required, nil
+}
+
+func GetPermissions() ([]models.Permission, error) {
+	SQL := `SELECT name,
+                   description
+            FROM   permissions
+            ORDER BY name`
+
+	permissions := make([]models.Permission, 0)
+
+	err := database.AudiophileDB.Select(&permissions, SQL)
+	if err != nil {
+		logrus.Printf("GetPermissions: cannot get permissions:%v", err)
+		return permissions, err
+	}
+	return permissions, nil
+}
+
+func GetRoleDefinitions() ([]models.RoleDefinition, error) {
+	SQL := `SELECT   name,
+                     description,
+                     array_remove(array_agg(permission ORDER BY permission), NULL) as permissions
+            FROM     role_definitions
+            LEFT JOIN role_permissions ON role_permissions.role = role_definitions.name
+            GROUP BY name, description
+            ORDER BY name`
+
+	roles := make([]models.RoleDefinition, 0)
+
+	err := database.AudiophileDB.Select(&roles, SQL)
+	if err != nil {
+		logrus.Printf("GetRoleDefinitions: cannot get roles:%v", err)
+		return roles, err
+	}
+	return roles, nil
+}
+
+func AddRoleDefinition(role models.RoleDefinition, tx *sqlx.Tx) error {
+	SQL := `INSERT INTO role_definitions(name, description)
+            VALUES   ($1, $2)`
+
+	_, err := tx.Exec(SQL, role.Name, role.Description)
+	if err != nil {
+		logrus.Printf("AddRoleDefinition: cannot add role:%v", err)
+		return err
+	}
+	return nil
+}
+
+func UpdateRoleDefinition(role models.RoleDefinition, tx *sqlx.Tx) (bool, error) {
+	SQL := `UPDATE role_definitions
+            SET    description=$2,
+                   updated_at=now()
+            WHERE  name=$1`
+
+	result, err := tx.Exec(SQL, role.Name, role.Description)
+	if err != nil {
+		logrus.Printf("UpdateRoleDefinition: cannot update role:%v", err)
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		logrus.Printf("UpdateRoleDefinition: cannot get affected rows:%v", err)
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// SetRolePermissions replaces the permission set of a role
+func SetRolePermissions(role string, permissions []string, tx *sqlx.Tx) error {
+	SQL := `DELETE FROM role_permissions
+            WHERE  role=$1`
+
+	_, err := tx.Exec(SQL, role)
+	if err != nil {
+		logrus.Printf("SetRolePermissions: cannot clear permissions:%v", err)
+		return err
+	}
+
+	if len(permissions) == 0 {
+		return nil
+	}
+
+	psql := sqrl.StatementBuilder.PlaceholderFormat(sqrl.Dollar)
+	insert := psql.Insert("role_permissions").Columns("role", "permission")
+	for _, permission := range permissions {
+		insert.Values(role, permission)
+	}
+
+	SQL, args, err := insert.ToSql()
+	if err != nil {
+		logrus.Printf("SetRolePermissions: not able to create sql string: %v", err)
+		return err
+	}
+
+	_, err = tx.Exec(SQL, args...)
+	if err != nil {
+		logrus.Printf("SetRolePermissions: cannot add permissions:%v", err)
+		return err
+	}
+	return nil
+}
+
+// DeleteRoleDefinition removes a role that is no longer assigned to anybody
+func DeleteRoleDefinition(role string) (bool, error) {
+	SQL := `DELETE FROM role_definitions
+            WHERE  name=$1
+            AND    NOT EXISTS (SELECT 1 FROM roles WHERE roles.role=$1)`
+
+	result, err := database.AudiophileDB.Exec(SQL, role)
+	if err != nil {
+		logrus.Printf("DeleteRoleDefinition: cannot delete role:%v", err)
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		logrus.Printf("DeleteRoleDefinition: cannot get affected rows:%v", err)
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// SetUserRoles replaces every role assigned to a user
+func SetUserRoles(userID uuid.UUID, roles []string, tx *sqlx.Tx) error {
+	SQL := `DELETE FROM roles
+            WHERE  user_id=$1`
+
+	_, err := tx.Exec(SQL, userID)
+	if err != nil {
+		logrus.Printf("SetUserRoles: cannot clear roles:%v", err)
+		return err
+	}
+
+	for _, role := range roles {
+		err = CreateRole(userID, models.UserProfile(role), tx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func GetOrders(filterCheck models.FiltersCheck) (models.TotalOrders, error) {
+	SQL := `SELECT  count(*) over () as total_count,
+                    id,
+                    user_id,
+                    address_id,
+                    total_amount,
+                    status,
+                    created_at
+            FROM    order_details
+            WHERE   archived_at IS NULL
+            ORDER BY created_at DESC
+            LIMIT $1 OFFSET $2`
+
+	totalOrders := models.TotalOrders{Orders: make([]models.AdminOrder, 0)}
+
+	err := database.AudiophileDB.Select(&totalOrders.Orders, SQL, filterCheck.Limit, filterCheck.Limit*filterCheck.Page)
+	if err != nil {
+		logrus.Printf("GetOrders: cannot get orders:%v", err)
+		return totalOrders, err
+	}
+
+	if len(totalOrders.Orders) > 0 {
+		totalOrders.TotalCount = totalOrders.Orders[0].TotalCount
+	}
+	return totalOrders, nil
+}
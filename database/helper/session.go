@@ -0,0 +1,174 @@
+package helper
+
+import (
+	"Audiophile/database"
+	"Audiophile/models"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// SessionDuration is how long a session stays alive without being used, every authenticated
+// request pushes the expiry forward by this much
+const SessionDuration = 30 * 24 * time.Hour
+
+func CreateRefreshToken(sessionID uuid.UUID, tokenHash string, expiresAt time.Time, tx *sqlx.Tx) error {
+	SQL := `INSERT INTO refresh_tokens(session_id, token_hash, expires_at)
+            VALUES   ($1, $2, $3)`
+
+	_, err := tx.Exec(SQL, sessionID, tokenHash, expiresAt)
+	if err != nil {
+		logrus.Printf("CreateRefreshToken: cannot create refresh token:%v", err)
+		return err
+	}
+	return nil
+}
+
+func FetchRefreshToken(tokenHash string) (models.RefreshTokenDetails, error) {
+	SQL := `SELECT  refresh_tokens.id,
+                    session_id,
+                    user_id,
+                    COALESCE(sessions.role, '') as role,
+                    mfa_verified,
+                    refresh_tokens.expires_at,
+                    used_at,
+                    sessions.expires_at as session_expires_at
+            FROM    refresh_tokens
+            JOIN    sessions ON sessions.id = refresh_tokens.session_id
+            WHERE   token_hash=$1`
+
+	var refreshToken models.RefreshTokenDetails
+
+	err := database.AudiophileDB.Get(&refreshToken, SQL, tokenHash)
+	if err != nil {
+		logrus.Printf("FetchRefreshToken: cannot get refresh token:%v", err)
+		return refreshToken, err
+	}
+	return refreshToken, nil
+}
+
+// UseRefreshToken marks a refresh token as used and reports false when it had already been used,
+// which happens when two requests race to rotate the same token
+func UseRefreshToken(refreshTokenID uuid.UUID, tx *sqlx.Tx) (bool, error) {
+	SQL := `UPDATE  refresh_tokens
+            SET     used_at=now()
+            WHERE   id=$1
+            AND     used_at IS NULL`
+
+	result, err := tx.Exec(SQL, refreshTokenID)
+	if err != nil {
+		logrus.Printf("UseRefreshToken: cannot use refresh token:%v", err)
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		logrus.Printf("UseRefreshToken: cannot get affected rows:%v", err)
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+func TouchSession(sessionID uuid.UUID, tx *sqlx.Tx) error {
+	SQL := `UPDATE  sessions
+            SET     updated_at=now(),
+                    expires_at=now() + make_interval(secs => $2)
+            WHERE   id=$1`
+
+	_, err := tx.Exec(SQL, sessionID, SessionDuration.Seconds())
+	if err != nil {
+		logrus.Printf("TouchSession: cannot update session:%v", err)
+		return err
+	}
+	return nil
+}
+
+// RevokeSession expires a session and with it every refresh token of its family
+func RevokeSession(sessionID uuid.UUID) error {
+	SQL := `UPDATE sessions
+            SET    expires_at=now()
+            WHERE  id=$1
+            AND    expires_at > now()`
+
+	_, err := database.AudiophileDB.Exec(SQL, sessionID)
+	if err != nil {
+		logrus.Printf("RevokeSession: cannot revoke session:%v", err)
+		return err
+	}
+	return nil
+}
+
+func RevokeUserSession(userID, sessionID uuid.UUID) (bool, error) {
+	SQL := `UPDATE sessions
+            SET    expires_at=now()
+            WHERE  id=$1
+            AND    user_id=$2
+            AND    expires_at > now()`
+
+	result, err := database.AudiophileDB.Exec(SQL, sessionID, userID)
+	if err != nil {
+		logrus.Printf("RevokeUserSession: cannot revoke session:%v", err)
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		logrus.Printf("RevokeUserSession: cannot get affected rows:%v", err)
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// CreateImpersonationSession opens a session for userID on behalf of an admin, it has no refresh
+// token and expires after duration no matter how it is used
+func CreateImpersonationSession(userID, impersonatorID uuid.UUID, device models.SessionDevice, duration time.Duration, tx *sqlx.Tx) (uuid.UUID, error) {
+	SQL := `INSERT INTO sessions(user_id, impersonator_id, role, device_name, user_agent, ip_address, mfa_verified, expires_at)
+            VALUES   ($1, $2, $3, $4, $5, $6, false, now() + make_interval(secs => $7))
+            RETURNING id`
+
+	var sessionID uuid.UUID
+
+	err := tx.Get(&sessionID, SQL, userID, impersonatorID, device.Role, device.DeviceName, device.UserAgent, device.IPAddress, duration.Seconds())
+	if err != nil {
+		logrus.Printf("CreateImpersonationSession: cannot create session:%v", err)
+		return sessionID, err
+	}
+	return sessionID, nil
+}
+
+func GetActiveSessions(userID uuid.UUID) ([]models.SessionDetails, error) {
+	SQL := `SELECT  id,
+                    COALESCE(device_name, '') as device_name,
+                    COALESCE(user_agent, '') as user_agent,
+                    COALESCE(ip_address, '') as ip_address,
+                    created_at,
+                    updated_at
+            FROM    sessions
+            WHERE   user_id=$1
+            AND     expires_at > now()
+            ORDER BY updated_at DESC`
+
+	sessions := make([]models.SessionDetails, 0)
+
+	err := database.AudiophileDB.Select(&sessions, SQL, userID)
+	if err != nil {
+		logrus.Printf("GetActiveSessions: cannot get sessions:%v", err)
+		return sessions, err
+	}
+	return sessions, nil
+}
+
+// RevokeAllSessions expires every active session of a user, including the ones they opened to
+// impersonate someone else
+func RevokeAllSessions(userID uuid.UUID, tx *sqlx.Tx) error {
+	SQL := `UPDATE sessions
+            SET    expires_at=now()
+            WHERE  (user_id=$1 OR impersonator_id=$1)
+            AND    expires_at > now()`
+
+	_, err := tx.Exec(SQL, userID)
+	if err != nil {
+		logrus.Printf("RevokeAllSessions: cannot revoke sessions:%v", err)
+		return err
+	}
+	return nil
+}
@@ -3,7 +3,6 @@ package helper
 import (
 	"Audiophile/database"
 	"Audiophile/models"
-	"firebase.google.com/go/auth"
 	"github.com/elgris/sqrl"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
@@ -13,56 +12,48 @@ import (
 	"strings"
 )
 
-func FetchPasswordAndIDANDRole(userMail, userRole string) (models.UserCredentials, error) {
-	SQL := `SELECT users.id,password,role
-            FROM   users
-            JOIN   roles ON users.id=roles.user_id
-            WHERE  email=$1
-            AND    roles.role=$2 
-            AND    archived_at IS NULL `
+// FetchLoginCredentials looks an account up by its email alone, Role lists every role of the user and is
+// only for display, what the user may do is decided by the permissions of all their roles together
+func FetchLoginCredentials(userMail string) (models.UserCredentials, error) {
+	SQL := `SELECT    users.id,
+                      password,
+                      COALESCE(string_agg(roles.role::text, ',' ORDER BY roles.role::text), '') as role
+            FROM      users
+            LEFT JOIN roles ON users.id=roles.user_id
+            WHERE     email=$1
+            AND       users.archived_at IS NULL
+            GROUP BY  users.id`
 
 	var userCredentials models.UserCredentials
 
-	err := database.AudiophileDB.Get(&userCredentials, SQL, userMail, userRole)
+	err := database.AudiophileDB.Get(&userCredentials, SQL, userMail)
 	if err != nil {
-		logrus.Printf("FetchPassword: Not able to fetch password, ID or role: %v", err)
+		logrus.Printf("FetchLoginCredentials: Not able to fetch password, ID or roles: %v", err)
 		return userCredentials, err
 	}
 	return userCredentials, nil
 }
 
-func CheckEmail(email string) error {
-	SQL := `SELECT id
-            FROM   users
-            WHERE  email = $1`
-
-	var userID int
-
-	err := database.AudiophileDB.Get(&userID, SQL, email)
-	if err != nil {
-		logrus.Printf("CheckEmail: cannot get userID from email:%v", err)
-		return err
-	}
-	return nil
-}
-
-func CreateSession(claims *models.Claims) error {
-	SQL := `INSERT INTO sessions(user_id)
-            VALUES   ($1)`
-	_, err := database.AudiophileDB.Exec(SQL, claims.ID)
+func CreateSession(userID uuid.UUID, device models.SessionDevice, tx *sqlx.Tx) (uuid.UUID, error) {
+	SQL := `INSERT INTO sessions(user_id, role, device_name, user_agent, ip_address, mfa_verified, expires_at)
+            VALUES   ($1, $2, $3, $4, $5, $6, now() + make_interval(secs => $7))
+            RETURNING id`
+	var sessionID uuid.UUID
+	err := tx.Get(&sessionID, SQL, userID, device.Role, device.DeviceName, device.UserAgent, device.IPAddress, device.MFAVerified, SessionDuration.Seconds())
 	if err != nil {
 		logrus.Printf("CreateSession: cannot create user session:%v", err)
-		return err
+		return sessionID, err
 	}
-	return nil
+	return sessionID, nil
 }
 
-func Logout(userID uuid.UUID) error {
+func Logout(sessionID uuid.UUID) error {
 	SQL := `UPDATE sessions
             SET    expires_at=now()
-            WHERE  user_id=$1`
+            WHERE  id=$1
+            AND    expires_at > now()`
 
-	_, err := database.AudiophileDB.Exec(SQL, userID)
+	_, err := database.AudiophileDB.Exec(SQL, sessionID)
 	if err != nil {
 		logrus.Printf("Logout: cannot do logout:%v", err)
 		return err
@@ -70,29 +61,44 @@ func Logout(userID uuid.UUID) error {
 	return nil
 }
 
-func CheckSession(userID uuid.UUID) (uuid.UUID, error) {
-	SQL := `SELECT id
-           FROM    sessions
-           WHERE   expires_at IS NULL
-           AND     user_id=$1`
-	var sessionID uuid.UUID
+// CheckSession verifies that the session a token was issued for is still active and slides its
+// expiry forward, it returns sql.ErrNoRows when the session has expired or been revoked or the
+// account has been suspended. Impersonation sessions keep their short, fixed expiry and only match
+// tokens carrying the same impersonator
+func CheckSession(sessionID, userID uuid.UUID, impersonatorID *uuid.UUID) error {
+	SQL := `UPDATE  sessions
+            SET     updated_at=now(),
+                    expires_at=CASE WHEN impersonator_id IS NULL
+                                    THEN now() + make_interval(secs => $3)
+                                    ELSE expires_at END
+            WHERE   id=$1
+            AND     user_id=$2
+            AND     impersonator_id IS NOT DISTINCT FROM $4
+            AND     expires_at > now()
+            AND     NOT EXISTS (SELECT 1
+                                FROM   users
+                                WHERE  users.id=$2
+                                AND    users.suspended_at IS NOT NULL)
+            RETURNING id`
+
+	var id uuid.UUID
 
-	err := database.AudiophileDB.Get(&sessionID, SQL, userID)
+	err := database.AudiophileDB.Get(&id, SQL, sessionID, userID, SessionDuration.Seconds(), impersonatorID)
 	if err != nil {
 		logrus.Printf("CheckSession: session expired:%v", err)
-		return sessionID, err
+		return err
 	}
-	return sessionID, nil
+	return nil
 }
 
-func CreateNewUser(userRecord *auth.UserRecord) (uuid.UUID, error) {
-	SQL := `INSERT INTO users(name, email, phone_no, password) 
-            VALUES ($1, $2, $3, $4)
+func CreateNewUser(externalIdentity models.ExternalIdentity, tx *sqlx.Tx) (uuid.UUID, error) {
+	SQL := `INSERT INTO users(name, email, phone_no, password, email_verified_at) 
+            VALUES ($1, $2, $3, $4, CASE WHEN $5 THEN now() END)
             RETURNING id`
 
 	var userID uuid.UUID
 
-	err := database.AudiophileDB.Get(&userID, SQL, userRecord.DisplayName, userRecord.Email, userRecord.PhoneNumber, "")
+	err := tx.Get(&userID, SQL, externalIdentity.Name, externalIdentity.Email, externalIdentity.PhoneNumber, "", externalIdentity.EmailVerified)
 	if err != nil {
 		logrus.Printf("CreateNewUser: cannot create new user:%v", err)
 		return userID, err
@@ -166,83 +172,137 @@ func UploadImage(imageURL string) (string, error) {
 	return imageID, nil
 }
 
-func GetUsers(filterCheck models.FiltersCheck) (models.TotalUser, error) {
-	var totalUser models.TotalUser
-	// language=SQL
-	SQL := `WITH  cte_User AS(
-
-            SELECT  
-                     count(*) over () as total_count,
-                     users.id as id,
-                     name,
-                     email,
-                     phone_no,
-                     password,
-                     age,
-                     users.created_at as created_at,
-                     users.updated_at as updated_at,
-                     role,
-                     address
-            FROM  users 
-            JOIN roles ON users.id=roles.user_id
-            JOIN   user_address ON roles.user_id=user_address.user_id
-            WHERE users.archived_at IS NULL
-            AND   user_address.archived_at IS NULL
-            AND   role=$1
-            AND    ($2 or name ilike '%'||$3||'%')
-            ORDER BY name
-            LIMIT $4 OFFSET $5
-            )
-            SELECT total_count,
-                      id,
-                     name,
-                     email,
-                     phone_no,
-                     password,
-                     age,
-                     created_at,
-                     updated_at,
-                     role,
-                     address
-            FROM     cte_User`
+// userListWhere keeps the users with an active address, searched by name
+func userListWhere(filterCheck models.FiltersCheck) sqrl.And {
+	where := sqrl.And{
+		sqrl.Expr("users.archived_at IS NULL"),
+		sqrl.Expr("user_address.archived_at IS NULL"),
+		sqrl.Expr("role = ?", models.UserRoleUser),
+	}
+	if filterCheck.IsSearched {
+		where = append(where, sqrl.Expr(`name ilike '%' || ? || '%'`, filterCheck.SearchedName))
+	}
+	return where
+}
 
-	userDetails := make([]models.UserDetails, 0)
+// the user listing has a row per address, so the address id is part of its order
+var byUserName = []sortKey{
+	{expr: "users.name", cast: "text"},
+	{expr: "users.id", cast: "uuid"},
+	{expr: "user_address.id", cast: "uuid"},
+}
 
-	err := database.AudiophileDB.Select(&userDetails, SQL, models.UserRoleUser, !filterCheck.IsSearched, filterCheck.SearchedName, filterCheck.Limit, filterCheck.Limit*filterCheck.Page)
+func GetUsers(filterCheck models.FiltersCheck) (models.TotalUser, error) {
+	totalUser := models.TotalUser{UserDetails: make([]models.UserDetails, 0)}
 
+	cursor, err := cursorValues(byUserName, filterCheck.Cursor)
 	if err != nil {
-		logrus.Printf("GetUsers: unable to fetch user details:%v", err)
+		return totalUser, err
+	}
+	reverse := filterCheck.Cursor != nil && filterCheck.Cursor.Before
+	offset := filterCheck.Limit * filterCheck.Page
+	if filterCheck.Cursor != nil {
+		offset = 0
+	}
+
+	psql := sqrl.StatementBuilder.PlaceholderFormat(sqrl.Dollar)
+	query := psql.Select("users.id as id",
+		"name",
+		"email",
+		"phone_no",
+		"password",
+		"age",
+		"users.created_at as created_at",
+		"users.updated_at as updated_at",
+		"role",
+		"address").
+		Column(keysetValues(byUserName)).
+		From("users").
+		Join("roles ON users.id=roles.user_id").
+		Join("user_address ON roles.user_id=user_address.user_id").
+		Where(userListWhere(filterCheck))
+	if cursor != "" {
+		query.Where(keysetWhere(byUserName, cursor, reverse))
+	}
+
+	// one row more than asked for tells whether there is another page
+	order, orderArgs := keysetOrder(byUserName, reverse)
+	SQL, args, err := query.Suffix("ORDER BY "+order+" LIMIT ? OFFSET ?", append(orderArgs, filterCheck.Limit+1, offset)...).ToSql()
+	if err != nil {
+		logrus.Printf("GetUsers: not able to create sql string: %v", err)
 		return totalUser, err
 	}
 
-	if len(userDetails) == 0 {
-		logrus.Printf("GetUsers:%v", err)
+	userDetails := make([]models.UserDetails, 0)
+
+	err = database.AudiophileDB.Select(&userDetails, SQL, args...)
+	if err != nil {
+		logrus.Printf("GetUsers: unable to fetch user details:%v", err)
 		return totalUser, err
 	}
 
+	hasMore := len(userDetails) > filterCheck.Limit
+	if hasMore {
+		userDetails = userDetails[:filterCheck.Limit]
+	}
+	if reverse {
+		for i, j := 0, len(userDetails)-1; i < j; i, j = i+1, j-1 {
+			userDetails[i], userDetails[j] = userDetails[j], userDetails[i]
+		}
+	}
 	totalUser.UserDetails = userDetails
-	totalUser.TotalCount = userDetails[0].TotalCount
+
+	if len(userDetails) > 0 {
+		totalUser.PrevCursor, totalUser.NextCursor = pageCursors(models.SortName, filterCheck.Cursor, filterCheck.Page, hasMore,
+			userDetails[0].SortKeys, userDetails[len(userDetails)-1].SortKeys)
+	}
+
+	if filterCheck.WithTotal {
+		SQL, args, err = psql.Select("count(*)").
+			From("users").
+			Join("roles ON users.id=roles.user_id").
+			Join("user_address ON roles.user_id=user_address.user_id").
+			Where(userListWhere(filterCheck)).
+			ToSql()
+		if err != nil {
+			logrus.Printf("GetUsers: not able to create sql string: %v", err)
+			return totalUser, err
+		}
+
+		var count int
+		err = database.AudiophileDB.Get(&count, SQL, args...)
+		if err != nil {
+			logrus.Printf("GetUsers: cannot count users:%v", err)
+			return totalUser, err
+		}
+		totalUser.TotalCount = &count
+	}
 	return totalUser, nil
 }
 
-func AddBrands(brandDetails *models.Brands) error {
-	SQL := `INSERT INTO brands(brand_name, brand_description)
-             VALUES   ($1, $2)`
+func AddBrands(brandDetails *models.Brands) (int, error) {
+	SQL := `INSERT INTO brands(brand_name, brand_description, slug, logo_image_id)
+             VALUES   ($1, $2, $3, $4)
+             RETURNING id`
 
-	_, err := database.AudiophileDB.Exec(SQL, brandDetails.BrandName, brandDetails.BrandDescription)
+	var brandID int
+	err := database.AudiophileDB.Get(&brandID, SQL, brandDetails.BrandName, brandDetails.BrandDescription, brandDetails.Slug, brandDetails.LogoImageID)
 	if err != nil {
 		logrus.Printf("AddBrands: cannot add brands:%v", err)
-		return err
+		return brandID, err
 	}
-	return nil
+	return brandID, nil
 }
 
+// AddCategory returns sql.ErrNoRows when the parent does not exist or is archived
 func AddCategory(categoryDetails *models.Categories) (uuid.UUID, error) {
-	SQL := `INSERT INTO category(name)
-            VALUES ($1)
+	SQL := `INSERT INTO category(name, parent_id)
+            SELECT $1, $2
+            WHERE  $2::uuid IS NULL
+            OR     EXISTS(SELECT 1 FROM category WHERE id = $2 AND archived_at IS NULL)
             RETURNING id`
 	var categoryID uuid.UUID
-	err := database.AudiophileDB.Get(&categoryID, SQL, categoryDetails.Name)
+	err := database.AudiophileDB.Get(&categoryID, SQL, categoryDetails.Name, categoryDetails.ParentID)
 	if err != nil {
 		logrus.Printf("AddCategory: cannot add category: %v", err)
 		return categoryID, err
@@ -250,33 +310,37 @@ func AddCategory(categoryDetails *models.Categories) (uuid.UUID, error) {
 	return categoryID, nil
 }
 
-func AddProduct(productDetails []models.Product, categoryID string) error {
-	psql := sqrl.StatementBuilder.PlaceholderFormat(sqrl.Dollar)
-	sql := psql.Insert("inventory").Columns("name", "price", "quantity", "category_id", "brand_id", "product_description")
-	for _, post := range productDetails {
-		sql.Values(post.Name, post.Price, post.Quantity, categoryID, post.BrandID, post.ProductDescription)
-	}
+// AddProduct inserts a single product so that its id can be paired with the product reliably, a multi
+// row insert returns its ids in no guaranteed order
+func AddProduct(product models.Product, categoryID string, tx *sqlx.Tx) (uuid.UUID, error) {
+	SQL := `INSERT INTO inventory(name, price, quantity, category_id, brand_id, product_description)
+            VALUES   ($1, $2, $3, $4, $5, $6)
+            RETURNING id`
 
-	SQL, args, err := sql.ToSql()
+	var productID uuid.UUID
+	err := tx.Get(&productID, SQL, product.Name, product.Price, product.Quantity, categoryID, product.BrandID, product.ProductDescription)
 	if err != nil {
-		logrus.Printf("AddProduct: not able to create sql string: %v", err)
-		return err
+		logrus.Printf("AddProduct: not able to add product to inventory:%v", err)
+		return productID, err
 	}
+	return productID, nil
+}
 
-	_, err = database.AudiophileDB.Exec(SQL, args...)
+func AddProductImages(productImagesDetails []models.ProductImages, productID string) error {
+	var position int
+	err := database.AudiophileDB.Get(&position, `SELECT COALESCE(max(position) + 1, 0)
+                                                 FROM   images_per_product
+                                                 WHERE  product_id=$1
+                                                 AND    archived_at IS NULL`, productID)
 	if err != nil {
-		logrus.Printf("AddProduct: not able to add product to inventory:%v", err)
+		logrus.Printf("AddProductImages: not able to get image position: %v", err)
 		return err
 	}
 
-	return nil
-}
-
-func AddProductImages(productImagesDetails []models.ProductImages, productID string) error {
 	psql := sqrl.StatementBuilder.PlaceholderFormat(sqrl.Dollar)
-	sql := psql.Insert("images_per_product").Columns("image_id", "product_id")
-	for _, post := range productImagesDetails {
-		sql.Values(post.ImageID, productID)
+	sql := psql.Insert("images_per_product").Columns("image_id", "product_id", "position")
+	for i, post := range productImagesDetails {
+		sql.Values(post.ImageID, productID, position+i)
 	}
 
 	SQL, args, err := sql.ToSql()
@@ -294,59 +358,132 @@ func AddProductImages(productImagesDetails []models.ProductImages, productID str
 	return nil
 }
 
+// productImagesSQL aggregates the images of inventory.id into a json array in display order
+const productImagesSQL = `COALESCE((SELECT json_agg(json_build_object('id', images_per_product.id,
+                                                                    'imageId', images.id,
+                                                                    'url', COALESCE(images.url, ''),
+                                                                    'position', images_per_product.position)
+                                             ORDER BY images_per_product.position, images_per_product.created_at)
+                                    FROM   images_per_product
+                                    JOIN   images ON images.id = images_per_product.image_id
+                                    WHERE  images_per_product.product_id = inventory.id
+                                    AND    images_per_product.archived_at IS NULL
+                                    AND    images.archived_at IS NULL), '[]')`
+
+// ViewProducts reads one page of products after, or before, the cursor of filterCheck, the first
+// page may still be skipped to by its number
 func ViewProducts(filterCheck models.FiltersCheck) (models.TotalProduct, error) {
-	var totalProducts models.TotalProduct
-
-	SQL := `WITH cte_inventory AS(
-            
-            SELECT 
-                     count(*) over () as total_count,
-                     inventory.id as id,
-                     name,
-                     category_id,
-                     price,
-                     quantity,
-                     url,
-                     brand_id
-            FROM   inventory
-                        LEFT JOIN images_per_product ON inventory.id = product_id
-                        LEFT JOIN images ON image_id = images.id
-            WHERE inventory.archived_at IS NULL
-            AND    ($1 or name ilike '%' || $2 || '%')
-            AND    inventory.archived_at IS NULL 
-            ORDER BY name
-            LIMIT  $3 OFFSET $4
-            
-            )
-           
-            SELECT   total_count,
-                     id,
-                     name,
-                     category_id,
-                     price,
-                     quantity,
-                     COALESCE(url, '') as url
-            FROM 
-                     cte_inventory`
+	totalProducts := models.TotalProduct{ProductDetails: make([]models.ProductDetails, 0)}
+
+	keys := catalogSortKeys(filterCheck)
+	cursor, err := cursorValues(keys, filterCheck.Cursor)
+	if err != nil {
+		return totalProducts, err
+	}
+	reverse := filterCheck.Cursor != nil && filterCheck.Cursor.Before
+	offset := filterCheck.Limit * filterCheck.Page
+	if filterCheck.Cursor != nil {
+		offset = 0
+	}
+
+	psql := sqrl.StatementBuilder.PlaceholderFormat(sqrl.Dollar)
+	query := psql.Select("inventory.id as id",
+		"name",
+		"category_id",
+		"price",
+		"quantity",
+		"created_at",
+		"updated_at",
+		productImagesSQL+" as images").
+		Column(keysetValues(keys)).
+		From("inventory").
+		Where(catalogWhere(filterCheck))
+	if join, ok := productSortJoins[filterCheck.Sort]; ok {
+		query.LeftJoin(join)
+	}
+	if cursor != "" {
+		query.Where(keysetWhere(keys, cursor, reverse))
+	}
+
+	// the sort keys bind the searched name when sorting by relevance, so the order goes into the suffix
+	// with its values. One row more than asked for tells whether there is another page
+	order, orderArgs := keysetOrder(keys, reverse)
+	SQL, args, err := query.Suffix("ORDER BY "+order+" LIMIT ? OFFSET ?", append(orderArgs, filterCheck.Limit+1, offset)...).ToSql()
+	if err != nil {
+		logrus.Printf("ViewProducts: not able to create sql string: %v", err)
+		return totalProducts, err
+	}
 
 	productDetails := make([]models.ProductDetails, 0)
 
-	err := database.AudiophileDB.Select(&productDetails, SQL, !filterCheck.IsSearched, filterCheck.SearchedName, filterCheck.Limit, filterCheck.Limit*filterCheck.Page)
+	err = database.AudiophileDB.Select(&productDetails, SQL, args...)
 	if err != nil {
 		logrus.Printf("ViewProducts: unable to fetch product details:%v", err)
 		return totalProducts, err
 	}
 
+	hasMore := len(productDetails) > filterCheck.Limit
+	if hasMore {
+		productDetails = productDetails[:filterCheck.Limit]
+	}
+	if reverse {
+		for i, j := 0, len(productDetails)-1; i < j; i, j = i+1, j-1 {
+			productDetails[i], productDetails[j] = productDetails[j], productDetails[i]
+		}
+	}
+
+	for i := range productDetails {
+		productDetails[i].StockStatus = models.StockStatus(productDetails[i].Quantity)
+	}
 	totalProducts.ProductDetails = productDetails
-	if len(productDetails) == 0 {
-		return totalProducts, nil
+
+	if len(productDetails) > 0 {
+		totalProducts.PrevCursor, totalProducts.NextCursor = pageCursors(filterCheck.Sort, filterCheck.Cursor, filterCheck.Page, hasMore,
+			productDetails[0].SortKeys, productDetails[len(productDetails)-1].SortKeys)
 	}
 
-	totalProducts.TotalCount = productDetails[0].TotalCount
+	if filterCheck.WithTotal {
+		count, err := CountProducts(filterCheck)
+		if err != nil {
+			return totalProducts, err
+		}
+		totalProducts.TotalCount = &count
+	}
 	return totalProducts, nil
 }
 
-func UpdateProduct(productID string, productDetails models.ProductUpdateDetails) error {
+func FetchProduct(productID uuid.UUID) (models.ProductDetail, error) {
+	SQL := `SELECT  inventory.id,
+                    inventory.name,
+                    COALESCE(product_description, '') as product_description,
+                    price,
+                    quantity,
+                    category.id as "category.id",
+                    COALESCE(category.name, '') as "category.name",
+                    brands.id as "brand.id",
+                    COALESCE(brands.brand_name, '') as "brand.name",
+                    COALESCE(brands.brand_description, '') as "brand.description",
+                    ` + productImagesSQL + ` as images,
+                    inventory.created_at,
+                    inventory.updated_at
+            FROM    inventory
+            LEFT JOIN category ON category.id = inventory.category_id
+            LEFT JOIN brands ON brands.id = inventory.brand_id
+            WHERE   inventory.id=$1
+            AND     inventory.archived_at IS NULL`
+
+	var product models.ProductDetail
+
+	err := database.AudiophileDB.Get(&product, SQL, productID)
+	if err != nil {
+		logrus.Printf("FetchProduct: cannot get product:%v", err)
+		return product, err
+	}
+	product.StockStatus = models.StockStatus(product.Quantity)
+	return product, nil
+}
+
+func UpdateProduct(productID string, productDetails models.ProductUpdateDetails, tx *sqlx.Tx) error {
 	SQL := `UPDATE  inventory
             SET     
                     name = $1,
@@ -355,7 +492,7 @@ func UpdateProduct(productID string, productDetails models.ProductUpdateDetails)
                     updated_at=now()
             WHERE   inventory.id = $4`
 
-	_, err := database.AudiophileDB.Exec(SQL, productDetails.Name, productDetails.Price, productDetails.Quantity, productID)
+	_, err := tx.Exec(SQL, productDetails.Name, productDetails.Price, productDetails.Quantity, productID)
 	if err != nil {
 		logrus.Printf("UpdateProduct: cannot update product:%v", err)
 		return err
@@ -0,0 +1,48 @@
+package helper
+
+import (
+	"Audiophile/database"
+	"Audiophile/models"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+func FetchEmailVerificationStatus(userID uuid.UUID) (models.EmailVerificationStatus, error) {
+	SQL := `SELECT  email,
+                    email_verified_at IS NOT NULL as verified
+            FROM    users
+            WHERE   id=$1
+            AND     archived_at IS NULL`
+
+	var status models.EmailVerificationStatus
+
+	err := database.AudiophileDB.Get(&status, SQL, userID)
+	if err != nil {
+		logrus.Printf("FetchEmailVerificationStatus: cannot get verification status:%v", err)
+		return status, err
+	}
+	return status, nil
+}
+
+// VerifyEmail marks the address as verified only while it is still the one on the account,
+// so a link mailed to an address the user has since changed away from does nothing
+func VerifyEmail(userID uuid.UUID, email string) (bool, error) {
+	SQL := `UPDATE  users
+            SET     email_verified_at=COALESCE(email_verified_at, now()),
+                    updated_at=now()
+            WHERE   id=$1
+            AND     email=$2
+            AND     archived_at IS NULL`
+
+	result, err := database.AudiophileDB.Exec(SQL, userID, email)
+	if err != nil {
+		logrus.Printf("VerifyEmail: cannot verify email:%v", err)
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		logrus.Printf("VerifyEmail: cannot get affected rows:%v", err)
+		return false, err
+	}
+	return rows == 1, nil
+}
@@ -0,0 +1,15 @@
+ALTER TABLE sessions ADD COLUMN role TEXT;
+ALTER TABLE sessions ADD COLUMN device_name TEXT;
+ALTER TABLE sessions ADD COLUMN user_agent TEXT;
+ALTER TABLE sessions ADD COLUMN ip_address TEXT;
+
+CREATE TABLE IF NOT EXISTS refresh_tokens(
+                                    id uuid primary key default gen_random_uuid() not null ,
+                                    session_id uuid REFERENCES sessions(id) NOT NULL ,
+                                    token_hash TEXT UNIQUE NOT NULL ,
+                                    created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL ,
+                                    expires_at TIMESTAMP WITH TIME ZONE NOT NULL ,
+                                    used_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_session_id_idx ON refresh_tokens(session_id);
@@ -0,0 +1,4 @@
+UPDATE sessions SET expires_at = now() + interval '30 days' WHERE expires_at IS NULL;
+ALTER TABLE sessions ALTER COLUMN expires_at SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions(user_id);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS password_reset_tokens(
+                                    id uuid primary key default gen_random_uuid() not null ,
+                                    user_id uuid REFERENCES users(id) NOT NULL ,
+                                    token_hash TEXT UNIQUE NOT NULL ,
+                                    created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL ,
+                                    expires_at TIMESTAMP WITH TIME ZONE NOT NULL ,
+                                    used_at TIMESTAMP WITH TIME ZONE
+);
@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS user_totp(
+                                    user_id uuid primary key REFERENCES users(id) not null ,
+                                    secret TEXT NOT NULL ,
+                                    last_used_step BIGINT ,
+                                    enabled_at TIMESTAMP WITH TIME ZONE ,
+                                    created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL ,
+                                    updated_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes(
+                                    id uuid primary key default gen_random_uuid() not null ,
+                                    user_id uuid REFERENCES users(id) NOT NULL ,
+                                    code_hash TEXT NOT NULL ,
+                                    created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL ,
+                                    used_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS mfa_recovery_codes_user_id_idx ON mfa_recovery_codes(user_id);
+
+CREATE TABLE IF NOT EXISTS mfa_challenges(
+                                    id uuid primary key default gen_random_uuid() not null ,
+                                    user_id uuid REFERENCES users(id) NOT NULL ,
+                                    attempts INTEGER DEFAULT 0 NOT NULL ,
+                                    created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL ,
+                                    expires_at TIMESTAMP WITH TIME ZONE NOT NULL ,
+                                    used_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS role_mfa_policies(
+                                    role TEXT primary key not null ,
+                                    mfa_required BOOLEAN DEFAULT false NOT NULL ,
+                                    updated_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL
+);
+
+ALTER TABLE sessions ADD COLUMN mfa_verified BOOLEAN DEFAULT false NOT NULL;
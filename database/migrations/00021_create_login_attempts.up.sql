@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS login_attempts(
+                                    kind TEXT NOT NULL ,
+                                    value TEXT NOT NULL ,
+                                    failures INTEGER DEFAULT 0 NOT NULL ,
+                                    last_failed_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL ,
+                                    locked_until TIMESTAMP WITH TIME ZONE ,
+                                    PRIMARY KEY (kind, value)
+);
@@ -0,0 +1,50 @@
+CREATE TABLE IF NOT EXISTS permissions(
+                                    name TEXT primary key not null ,
+                                    description TEXT DEFAULT '' NOT NULL
+);
+
+INSERT INTO permissions(name, description) VALUES
+    ('users.read', 'View customer accounts'),
+    ('users.manage', 'Suspend, reactivate and log out customer accounts'),
+    ('inventory.read', 'View the inventory including archived details'),
+    ('inventory.write', 'Manage products, images, categories and brands'),
+    ('orders.read', 'View orders of every customer'),
+    ('security.manage', 'Manage two-factor policies and login lockouts'),
+    ('roles.manage', 'Manage roles and assign them to users');
+
+CREATE TABLE IF NOT EXISTS role_definitions(
+                                    name TEXT primary key not null ,
+                                    description TEXT DEFAULT '' NOT NULL ,
+                                    created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL ,
+                                    updated_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL
+);
+
+INSERT INTO role_definitions(name, description) VALUES
+    ('admin', 'Full access'),
+    ('user', 'Customer'),
+    ('inventory_manager', 'Warehouse staff managing the catalog and stock'),
+    ('support', 'Support staff with read only access to customers and orders');
+
+CREATE TABLE IF NOT EXISTS role_permissions(
+                                    role TEXT REFERENCES role_definitions(name) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL ,
+                                    permission TEXT REFERENCES permissions(name) ON DELETE CASCADE NOT NULL ,
+                                    PRIMARY KEY (role, permission)
+);
+
+INSERT INTO role_permissions(role, permission) SELECT 'admin', name FROM permissions;
+INSERT INTO role_permissions(role, permission) VALUES
+    ('inventory_manager', 'inventory.read'),
+    ('inventory_manager', 'inventory.write'),
+    ('support', 'users.read'),
+    ('support', 'orders.read'),
+    ('support', 'inventory.read');
+
+ALTER TABLE roles ALTER COLUMN role TYPE TEXT USING role::text;
+
+DELETE FROM roles duplicate USING roles original
+WHERE  duplicate.user_id = original.user_id
+AND    duplicate.role = original.role
+AND    duplicate.id > original.id;
+
+ALTER TABLE roles ADD CONSTRAINT roles_role_fkey FOREIGN KEY (role) REFERENCES role_definitions(name) ON UPDATE CASCADE;
+ALTER TABLE roles ADD CONSTRAINT roles_user_id_role_key UNIQUE (user_id, role);
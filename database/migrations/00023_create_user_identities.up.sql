@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS user_identities(
+                                    id uuid primary key default gen_random_uuid() not null ,
+                                    user_id uuid REFERENCES users(id) NOT NULL ,
+                                    provider TEXT NOT NULL ,
+                                    subject TEXT NOT NULL ,
+                                    email TEXT DEFAULT '' NOT NULL ,
+                                    created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL ,
+                                    UNIQUE (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS user_identities_user_id_idx ON user_identities(user_id);
@@ -0,0 +1,13 @@
+ALTER TABLE users ADD COLUMN suspended_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN suspension_reason TEXT;
+
+CREATE TABLE IF NOT EXISTS admin_audit_log(
+                                    id uuid primary key default gen_random_uuid() not null ,
+                                    actor_id uuid REFERENCES users(id) NOT NULL ,
+                                    action TEXT NOT NULL ,
+                                    target_user_id uuid REFERENCES users(id) ,
+                                    details JSONB DEFAULT '{}' NOT NULL ,
+                                    created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS admin_audit_log_target_user_id_idx ON admin_audit_log(target_user_id, created_at);
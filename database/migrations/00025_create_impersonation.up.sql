@@ -0,0 +1,8 @@
+ALTER TABLE sessions ADD COLUMN impersonator_id uuid REFERENCES users(id);
+
+INSERT INTO permissions(name, description) VALUES
+    ('users.impersonate', 'See the shop as a customer to debug their cart and checkout');
+
+INSERT INTO role_permissions(role, permission) VALUES
+    ('admin', 'users.impersonate'),
+    ('support', 'users.impersonate');
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS api_keys(
+                                    id uuid primary key default gen_random_uuid() not null ,
+                                    name TEXT NOT NULL ,
+                                    prefix TEXT NOT NULL ,
+                                    key_hash TEXT UNIQUE NOT NULL ,
+                                    scopes TEXT[] DEFAULT '{}' NOT NULL ,
+                                    created_by uuid REFERENCES users(id) NOT NULL ,
+                                    expires_at TIMESTAMP WITH TIME ZONE ,
+                                    last_used_at TIMESTAMP WITH TIME ZONE ,
+                                    revoked_at TIMESTAMP WITH TIME ZONE ,
+                                    revoked_by uuid REFERENCES users(id) ,
+                                    created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL
+);
@@ -0,0 +1,14 @@
+ALTER TABLE users ADD COLUMN phone_verified_at TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE IF NOT EXISTS phone_otps(
+                                    id uuid primary key default gen_random_uuid() not null ,
+                                    user_id uuid REFERENCES users(id) NOT NULL ,
+                                    phone_no TEXT NOT NULL ,
+                                    code_hash TEXT NOT NULL ,
+                                    attempts INTEGER DEFAULT 0 NOT NULL ,
+                                    created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL ,
+                                    expires_at TIMESTAMP WITH TIME ZONE NOT NULL ,
+                                    used_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS phone_otps_user_id_idx ON phone_otps(user_id, created_at);
@@ -0,0 +1,10 @@
+ALTER TABLE images_per_product ADD COLUMN position INTEGER DEFAULT 0 NOT NULL;
+ALTER TABLE images_per_product ADD COLUMN created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL;
+
+UPDATE images_per_product
+SET    position = ordered.position
+FROM   (SELECT id, row_number() over (PARTITION BY product_id ORDER BY id) - 1 as position
+        FROM   images_per_product) ordered
+WHERE  ordered.id = images_per_product.id;
+
+CREATE INDEX IF NOT EXISTS images_per_product_product_id_idx ON images_per_product(product_id, position);
@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS inventory_brand_idx ON inventory(brand_id) WHERE archived_at IS NULL;
+CREATE INDEX IF NOT EXISTS inventory_category_idx ON inventory(category_id) WHERE archived_at IS NULL;
+CREATE INDEX IF NOT EXISTS inventory_price_idx ON inventory(price) WHERE archived_at IS NULL;
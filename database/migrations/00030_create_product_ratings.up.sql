@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS product_ratings(
+    id uuid primary key default gen_random_uuid() not null ,
+    product_id uuid REFERENCES inventory(id) NOT NULL ,
+    user_id uuid REFERENCES users(id) NOT NULL ,
+    rating SMALLINT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL ,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL ,
+    UNIQUE(product_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS inventory_created_at_idx ON inventory(created_at) WHERE archived_at IS NULL;
+CREATE INDEX IF NOT EXISTS order_details_completed_idx ON order_details USING GIN(cart_id) WHERE status = 'completed';
@@ -0,0 +1,55 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE inventory ADD COLUMN search_vector tsvector;
+
+CREATE OR REPLACE FUNCTION product_search_document(product_name TEXT, description TEXT, product_brand_id INTEGER, product_category_id uuid)
+    RETURNS tsvector AS $$
+    SELECT setweight(to_tsvector('english', COALESCE(product_name, '')), 'A') ||
+           setweight(to_tsvector('english', COALESCE((SELECT brand_name FROM brands WHERE id = product_brand_id), '')), 'B') ||
+           setweight(to_tsvector('english', COALESCE((SELECT name FROM category WHERE id = product_category_id), '')), 'C') ||
+           setweight(to_tsvector('english', COALESCE(description, '')), 'D')
+$$ LANGUAGE sql STABLE;
+
+CREATE OR REPLACE FUNCTION inventory_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector := product_search_document(NEW.name, NEW.product_description, NEW.brand_id, NEW.category_id);
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER inventory_search_vector_trigger
+    BEFORE INSERT OR UPDATE OF name, product_description, brand_id, category_id ON inventory
+    FOR EACH ROW EXECUTE PROCEDURE inventory_search_vector_update();
+
+-- renaming a brand or category changes the documents of its products
+CREATE OR REPLACE FUNCTION brand_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    UPDATE inventory
+    SET    search_vector = product_search_document(name, product_description, brand_id, category_id)
+    WHERE  brand_id = NEW.id;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER brand_search_vector_trigger
+    AFTER UPDATE OF brand_name ON brands
+    FOR EACH ROW EXECUTE PROCEDURE brand_search_vector_update();
+
+CREATE OR REPLACE FUNCTION category_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    UPDATE inventory
+    SET    search_vector = product_search_document(name, product_description, brand_id, category_id)
+    WHERE  category_id = NEW.id;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER category_search_vector_trigger
+    AFTER UPDATE OF name ON category
+    FOR EACH ROW EXECUTE PROCEDURE category_search_vector_update();
+
+UPDATE inventory
+SET    search_vector = product_search_document(name, product_description, brand_id, category_id);
+
+CREATE INDEX IF NOT EXISTS inventory_search_vector_idx ON inventory USING GIN(search_vector);
+CREATE INDEX IF NOT EXISTS inventory_name_trgm_idx ON inventory USING GIN(name gin_trgm_ops);
@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS brands_name_trgm_idx ON brands USING GIN(brand_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS category_name_trgm_idx ON category USING GIN(name gin_trgm_ops) WHERE archived_at IS NULL;
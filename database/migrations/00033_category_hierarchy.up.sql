@@ -0,0 +1,3 @@
+ALTER TABLE category ADD COLUMN parent_id uuid REFERENCES category(id);
+
+CREATE INDEX IF NOT EXISTS category_parent_id_idx ON category(parent_id) WHERE archived_at IS NULL;
@@ -0,0 +1,17 @@
+ALTER TABLE brands ADD COLUMN slug TEXT;
+ALTER TABLE brands ADD COLUMN logo_image_id uuid REFERENCES images(id);
+ALTER TABLE brands ADD COLUMN created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL;
+ALTER TABLE brands ADD COLUMN updated_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL;
+ALTER TABLE brands ADD COLUMN archived_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE brands
+SET    slug = trim(both '-' from lower(regexp_replace(COALESCE(brand_name, ''), '[^a-zA-Z0-9]+', '-', 'g')));
+
+-- brands without a usable name or sharing a name with an older brand get their id appended
+UPDATE brands
+SET    slug = CASE WHEN slug = '' THEN 'brand' ELSE slug END || '-' || id
+WHERE  slug = ''
+OR     id NOT IN (SELECT min(id) FROM brands GROUP BY slug);
+
+ALTER TABLE brands ALTER COLUMN slug SET NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS brands_slug_idx ON brands(slug);
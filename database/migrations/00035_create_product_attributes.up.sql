@@ -0,0 +1,36 @@
+create type attribute_type as enum('number', 'range', 'text', 'enum', 'boolean');
+
+-- a definition applies to the products of its category and of all categories below it
+CREATE TABLE IF NOT EXISTS attribute_definitions(
+    id uuid primary key default gen_random_uuid() not null ,
+    category_id uuid REFERENCES category(id) NOT NULL ,
+    key TEXT NOT NULL CHECK (key ~ '^[a-z0-9]+(_[a-z0-9]+)*$'),
+    name TEXT NOT NULL ,
+    type attribute_type NOT NULL ,
+    unit TEXT ,
+    allowed_values TEXT[] ,
+    min_value FLOAT ,
+    max_value FLOAT ,
+    required BOOLEAN DEFAULT false NOT NULL ,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL ,
+    archived_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS attribute_definitions_key_idx ON attribute_definitions(category_id, key) WHERE archived_at IS NULL;
+
+-- number and boolean values use their own column, range values the min and max pair and text and
+-- enum values text_value
+CREATE TABLE IF NOT EXISTS product_attributes(
+    product_id uuid REFERENCES inventory(id) NOT NULL ,
+    definition_id uuid REFERENCES attribute_definitions(id) NOT NULL ,
+    number_value FLOAT ,
+    range_min FLOAT ,
+    range_max FLOAT ,
+    text_value TEXT ,
+    bool_value BOOLEAN ,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL ,
+    PRIMARY KEY (product_id, definition_id)
+);
+
+CREATE INDEX IF NOT EXISTS product_attributes_number_idx ON product_attributes(definition_id, number_value);
+CREATE INDEX IF NOT EXISTS product_attributes_text_idx ON product_attributes(definition_id, text_value);
@@ -0,0 +1,392 @@
+package handler
+
+import (
+	"Audiophile/database"
+	"Audiophile/database/helper"
+	"Audiophile/models"
+	"Audiophile/utilities"
+	"database/sql"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+// targetUser reads the userID url param and rejects admins acting on their own account or on an account
+// holding permissions they do not have themselves, such as the only admin who can manage roles
+func targetUser(w http.ResponseWriter, r *http.Request, actor models.ContextValues) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("targetUser: invalid user id:%v", err)
+		return userID, false
+	}
+	if userID == actor.ID {
+		w.WriteHeader(http.StatusBadRequest)
+		_, err = w.Write([]byte("ERROR: admins cannot change their own account from here"))
+		if err != nil {
+			return userID, false
+		}
+		return userID, false
+	}
+
+	granted, err := actorPermissions(actor)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("targetUser: cannot get actor permissions:%v", err)
+		return userID, false
+	}
+	targetPermissions, err := helper.FetchUserPermissions(userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("targetUser: cannot get target permissions:%v", err)
+		return userID, false
+	}
+	for _, permission := range targetPermissions {
+		if !granted[permission] {
+			w.WriteHeader(http.StatusForbidden)
+			_, err = w.Write([]byte("ERROR: cannot act on an account with permissions you do not have"))
+			if err != nil {
+				return userID, false
+			}
+			return userID, false
+		}
+	}
+	return userID, true
+}
+
+// actorPermissions returns what the caller may do, for api keys only the scopes their creator still has
+func actorPermissions(actor models.ContextValues) (map[string]bool, error) {
+	granted, err := helper.FetchUserPermissions(actor.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	grantedSet := make(map[string]bool, len(granted))
+	for _, permission := range granted {
+		grantedSet[permission] = true
+	}
+	if actor.APIKeyID == uuid.Nil {
+		return grantedSet, nil
+	}
+
+	scopedSet := make(map[string]bool, len(actor.Scopes))
+	for _, scope := range actor.Scopes {
+		scopedSet[scope] = grantedSet[scope]
+	}
+	return scopedSet, nil
+}
+
+func GetUserDetails(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("GetUserDetails: invalid user id:%v", err)
+		return
+	}
+
+	userDetails, err := helper.FetchAdminUserDetails(userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("GetUserDetails: cannot get user:%v", err)
+		return
+	}
+
+	userDetails.Addresses, err = helper.GetExportAddresses(userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("GetUserDetails: cannot get addresses:%v", err)
+		return
+	}
+	userDetails.Orders, err = helper.GetExportOrders(userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("GetUserDetails: cannot get orders:%v", err)
+		return
+	}
+
+	err = utilities.Encoder(w, userDetails)
+	if err != nil {
+		logrus.Printf("GetUserDetails:%v", err)
+		return
+	}
+}
+
+// SuspendUser blocks the account from logging in and ends every session it has
+func SuspendUser(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("SuspendUser:Context for ID:%v", ok)
+		return
+	}
+	userID, ok := targetUser(w, r, contextValues)
+	if !ok {
+		return
+	}
+
+	var request models.SuspendUserRequest
+	decoderErr := utilities.Decoder(r, &request)
+	request.Reason = strings.TrimSpace(request.Reason)
+	if decoderErr != nil || request.Reason == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("Decoder error:%v", decoderErr)
+		_, err := w.Write([]byte("ERROR: a reason is required"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	suspended := false
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var err error
+		suspended, err = helper.SuspendUser(userID, request.Reason, tx)
+		if err != nil || !suspended {
+			return err
+		}
+		err = helper.RevokeAllSessions(userID, tx)
+		if err != nil {
+			return err
+		}
+		return helper.RecordAdminAction(contextValues.ID, models.AuditUserSuspended, userID, map[string]interface{}{"reason": request.Reason}, tx)
+	})
+	if txErr != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("SuspendUser:%v", txErr)
+		return
+	}
+	if !suspended {
+		w.WriteHeader(http.StatusConflict)
+		_, err := w.Write([]byte("ERROR: user not found or already suspended"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	message := "suspended user successfully"
+	err := utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("SuspendUser:%v", err)
+		return
+	}
+}
+
+func ReactivateUser(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ReactivateUser:Context for ID:%v", ok)
+		return
+	}
+	userID, ok := targetUser(w, r, contextValues)
+	if !ok {
+		return
+	}
+
+	reactivated := false
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var err error
+		reactivated, err = helper.ReactivateUser(userID, tx)
+		if err != nil || !reactivated {
+			return err
+		}
+		return helper.RecordAdminAction(contextValues.ID, models.AuditUserReactivated, userID, nil, tx)
+	})
+	if txErr != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ReactivateUser:%v", txErr)
+		return
+	}
+	if !reactivated {
+		w.WriteHeader(http.StatusConflict)
+		_, err := w.Write([]byte("ERROR: user not found or not suspended"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	message := "reactivated user successfully"
+	err := utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("ReactivateUser:%v", err)
+		return
+	}
+}
+
+// AddUserRole promotes a user by granting one more role on top of the ones they have
+func AddUserRole(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("AddUserRole:Context for ID:%v", ok)
+		return
+	}
+	userID, ok := targetUser(w, r, contextValues)
+	if !ok {
+		return
+	}
+	role := chi.URLParam(r, "role")
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		err := helper.CreateRole(userID, models.UserProfile(role), tx)
+		if err != nil {
+			return err
+		}
+		return helper.RecordAdminAction(contextValues.ID, models.AuditUserRoleAdded, userID, map[string]interface{}{"role": role}, tx)
+	})
+	if txErr != nil {
+		if utilities.IsForeignKeyViolation(txErr) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, err := w.Write([]byte("ERROR: unknown user or role"))
+			if err != nil {
+				return
+			}
+			return
+		}
+		if utilities.IsUniqueViolation(txErr) {
+			w.WriteHeader(http.StatusConflict)
+			_, err := w.Write([]byte("ERROR: user already has this role"))
+			if err != nil {
+				return
+			}
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("AddUserRole:%v", txErr)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	message := "added role successfully"
+	err := utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("AddUserRole:%v", err)
+		return
+	}
+}
+
+// RemoveUserRole demotes a user, the last role of a user cannot be removed
+func RemoveUserRole(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("RemoveUserRole:Context for ID:%v", ok)
+		return
+	}
+	userID, ok := targetUser(w, r, contextValues)
+	if !ok {
+		return
+	}
+	role := chi.URLParam(r, "role")
+
+	removed := false
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var err error
+		removed, err = helper.RemoveUserRole(userID, role, tx)
+		if err != nil || !removed {
+			return err
+		}
+		return helper.RecordAdminAction(contextValues.ID, models.AuditUserRoleRemoved, userID, map[string]interface{}{"role": role}, tx)
+	})
+	if txErr != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("RemoveUserRole:%v", txErr)
+		return
+	}
+	if !removed {
+		w.WriteHeader(http.StatusConflict)
+		_, err := w.Write([]byte("ERROR: user does not have this role or it is their only one"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	message := "removed role successfully"
+	err := utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("RemoveUserRole:%v", err)
+		return
+	}
+}
+
+// ForceLogout ends every session of a user, they can log in again right away
+func ForceLogout(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ForceLogout:Context for ID:%v", ok)
+		return
+	}
+	userID, ok := targetUser(w, r, contextValues)
+	if !ok {
+		return
+	}
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		err := helper.RevokeAllSessions(userID, tx)
+		if err != nil {
+			return err
+		}
+		return helper.RecordAdminAction(contextValues.ID, models.AuditUserLoggedOut, userID, nil, tx)
+	})
+	if txErr != nil {
+		if utilities.IsForeignKeyViolation(txErr) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ForceLogout:%v", txErr)
+		return
+	}
+
+	message := "logged out user successfully"
+	err := utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("ForceLogout:%v", err)
+		return
+	}
+}
+
+// GetAuditLog lists admin actions newest first, ?userID= limits it to actions on one user
+func GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	filterCheck, err := filters(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("GetAuditLog:filterCheck:%v", err)
+		return
+	}
+
+	var targetUserID *uuid.UUID
+	if strUserID := r.URL.Query().Get("userID"); strUserID != "" {
+		userID, err := uuid.Parse(strUserID)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			logrus.Printf("GetAuditLog: invalid user id:%v", err)
+			return
+		}
+		targetUserID = &userID
+	}
+
+	auditLog, err := helper.GetAuditLog(targetUserID, filterCheck)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("GetAuditLog: cannot get audit log:%v", err)
+		return
+	}
+
+	err = utilities.Encoder(w, auditLog)
+	if err != nil {
+		logrus.Printf("GetAuditLog:%v", err)
+		return
+	}
+}
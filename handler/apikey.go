@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"Audiophile/database/helper"
+	"Audiophile/models"
+	"Audiophile/utilities"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	apiKeySize = 32
+	// apiKeyPrefixLength is how much of a key is stored in clear so admins can recognise it
+	apiKeyPrefixLength = 10
+)
+
+// CreateAPIKey issues a key for integrations from a two-factor verified session, the key is only shown
+// in this response and can carry no scope the creating admin does not have
+func CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("CreateAPIKey:Context for ID:%v", ok)
+		return
+	}
+	// keys pass the mfa policy on their own, so they may only come from a session that completed it
+	if !contextValues.MFAVerified {
+		w.WriteHeader(http.StatusForbidden)
+		_, err := w.Write([]byte("ERROR: log in with two-factor authentication to create api keys"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	var request models.CreateAPIKeyRequest
+	decoderErr := utilities.Decoder(r, &request)
+	request.Name = strings.TrimSpace(request.Name)
+	if decoderErr != nil || request.Name == "" || len(request.Scopes) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("Decoder error:%v", decoderErr)
+		_, err := w.Write([]byte("ERROR: name and at least one scope are required"))
+		if err != nil {
+			return
+		}
+		return
+	}
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, err := w.Write([]byte("ERROR: expiry must be in the future"))
+		if err != nil {
+			return
+		}
+		return
+	}
+	if !validatePermissions(w, request.Scopes) {
+		return
+	}
+
+	granted, err := helper.FetchUserPermissions(contextValues.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("CreateAPIKey: cannot get permissions:%v", err)
+		return
+	}
+	grantedSet := make(map[string]bool, len(granted))
+	for _, permission := range granted {
+		grantedSet[permission] = true
+	}
+	for _, scope := range request.Scopes {
+		if !grantedSet[scope] {
+			w.WriteHeader(http.StatusForbidden)
+			_, err = w.Write([]byte("ERROR: cannot grant a scope you do not have: " + scope))
+			if err != nil {
+				return
+			}
+			return
+		}
+	}
+
+	secret, err := utilities.GenerateToken(apiKeySize)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("CreateAPIKey: cannot generate key:%v", err)
+		return
+	}
+	key := models.APIKeyPrefix + secret
+
+	apiKey, err := helper.CreateAPIKey(request.Name, key[:apiKeyPrefixLength], utilities.HashToken(key), request.Scopes, request.ExpiresAt, contextValues.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("CreateAPIKey: cannot store key:%v", err)
+		return
+	}
+
+	userOutboundData := make(map[string]interface{})
+	userOutboundData["key"] = key
+	userOutboundData["apiKey"] = apiKey
+
+	w.WriteHeader(http.StatusCreated)
+	err = utilities.Encoder(w, userOutboundData)
+	if err != nil {
+		logrus.Printf("CreateAPIKey:%v", err)
+		return
+	}
+}
+
+func GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	apiKeys, err := helper.GetAPIKeys()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("GetAPIKeys: cannot get api keys:%v", err)
+		return
+	}
+
+	err = utilities.Encoder(w, apiKeys)
+	if err != nil {
+		logrus.Printf("GetAPIKeys:%v", err)
+		return
+	}
+}
+
+func RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("RevokeAPIKey:Context for ID:%v", ok)
+		return
+	}
+
+	keyID, err := uuid.Parse(chi.URLParam(r, "keyID"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("RevokeAPIKey: invalid key id:%v", err)
+		return
+	}
+
+	revoked, err := helper.RevokeAPIKey(keyID, contextValues.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("RevokeAPIKey: cannot revoke key:%v", err)
+		return
+	}
+	if !revoked {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	message := "revoked api key successfully"
+	err = utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("RevokeAPIKey:%v", err)
+		return
+	}
+}
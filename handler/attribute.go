@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"Audiophile/database/helper"
+	"Audiophile/models"
+	"Audiophile/utilities"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	attributeParamPrefix = "attr."
+	maxAttributeFilters  = 10
+)
+
+// parseAttributeFilters reads attr.<key>=value, which may be repeated, and attr.<key>.min and
+// attr.<key>.max from the query
+func parseAttributeFilters(query url.Values) ([]models.AttributeFilter, error) {
+	byKey := make(map[string]*models.AttributeFilter)
+	for param, values := range query {
+		if !strings.HasPrefix(param, attributeParamPrefix) {
+			continue
+		}
+		key := strings.TrimPrefix(param, attributeParamPrefix)
+		bound := ""
+		if i := strings.LastIndex(key, "."); i >= 0 {
+			key, bound = key[:i], key[i+1:]
+		}
+		if !models.IsAttributeKey(key) {
+			return nil, errors.New("invalid attribute filter " + param)
+		}
+
+		filter, ok := byKey[key]
+		if !ok {
+			filter = &models.AttributeFilter{Key: key}
+			byKey[key] = filter
+		}
+
+		switch bound {
+		case "":
+			filter.Values = append(filter.Values, values...)
+		case "min", "max":
+			number, err := strconv.ParseFloat(values[0], 64)
+			if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+				return nil, errors.New("invalid attribute filter " + param)
+			}
+			if bound == "min" {
+				filter.Min = &number
+			} else {
+				filter.Max = &number
+			}
+		default:
+			return nil, errors.New("invalid attribute filter " + param)
+		}
+	}
+	if len(byKey) > maxAttributeFilters {
+		return nil, errors.New("too many attribute filters")
+	}
+
+	filters := make([]models.AttributeFilter, 0, len(byKey))
+	for _, filter := range byKey {
+		filters = append(filters, *filter)
+	}
+	sort.Slice(filters, func(i, j int) bool {
+		return filters[i].Key < filters[j].Key
+	})
+	return filters, nil
+}
+
+// parseProductAttributes checks attribute values against the definitions of the product's category,
+// null values are returned apart as the definitions to remove
+func parseProductAttributes(definitions []models.AttributeDefinition, attributes map[string]json.RawMessage) (map[uuid.UUID]models.AttributeValue, []string, error) {
+	byKey := make(map[string]models.AttributeDefinition, len(definitions))
+	for _, definition := range definitions {
+		byKey[definition.Key] = definition
+	}
+
+	values := make(map[uuid.UUID]models.AttributeValue, len(attributes))
+	removed := make([]string, 0)
+	for key, raw := range attributes {
+		definition, ok := byKey[key]
+		if !ok {
+			return nil, nil, errors.New("unknown attribute " + key)
+		}
+		if string(raw) == "null" {
+			if definition.Required {
+				return nil, nil, errors.New("attribute " + key + " is required")
+			}
+			removed = append(removed, definition.ID.String())
+			continue
+		}
+		value, err := definition.Parse(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		values[definition.ID] = value
+	}
+	return values, removed, nil
+}
+
+// requiredAttributes returns an error naming the first required attribute missing from attributes
+func requiredAttributes(definitions []models.AttributeDefinition, attributes map[string]json.RawMessage) error {
+	for _, definition := range definitions {
+		if _, ok := attributes[definition.Key]; definition.Required && !ok {
+			return errors.New("attribute " + definition.Key + " is required")
+		}
+	}
+	return nil
+}
+
+func GetCategoryAttributes(w http.ResponseWriter, r *http.Request) {
+	categoryID, ok := categoryParam(w, r)
+	if !ok {
+		return
+	}
+
+	definitions, err := helper.GetCategoryAttributes(categoryID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("GetCategoryAttributes:%v", err)
+		return
+	}
+
+	err = utilities.Encoder(w, definitions)
+	if err != nil {
+		logrus.Printf("GetCategoryAttributes:%v", err)
+		return
+	}
+}
+
+func AddAttributeDefinition(w http.ResponseWriter, r *http.Request) {
+	categoryID, ok := categoryParam(w, r)
+	if !ok {
+		return
+	}
+
+	var definition models.AttributeDefinition
+	decoderErr := utilities.Decoder(r, &definition)
+	if decoderErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("Decoder error:%v", decoderErr)
+		return
+	}
+	definition.CategoryID = categoryID
+
+	err := definition.Validate()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, err = w.Write([]byte("ERROR: " + err.Error()))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	definitionID, err := helper.AddAttributeDefinition(definition)
+	if err != nil {
+		if err == sql.ErrNoRows || utilities.IsUniqueViolation(err) {
+			w.WriteHeader(http.StatusConflict)
+			_, err = w.Write([]byte("ERROR: attribute " + definition.Key + " is already defined for this category, above or below it"))
+			if err != nil {
+				return
+			}
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("AddAttributeDefinition:%v", err)
+		return
+	}
+
+	userOutboundData := make(map[string]uuid.UUID)
+	userOutboundData["Successfully Added Attribute: ID is"] = definitionID
+
+	err = utilities.Encoder(w, userOutboundData)
+	if err != nil {
+		logrus.Printf("AddAttributeDefinition:%v", err)
+		return
+	}
+}
+
+func ArchiveAttributeDefinition(w http.ResponseWriter, r *http.Request) {
+	categoryID, ok := categoryParam(w, r)
+	if !ok {
+		return
+	}
+
+	archived, err := helper.ArchiveAttributeDefinition(categoryID, chi.URLParam(r, "key"))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ArchiveAttributeDefinition:%v", err)
+		return
+	}
+	if !archived {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	message := "archived attribute successfully"
+	err = utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("ArchiveAttributeDefinition:%v", err)
+		return
+	}
+}
@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"Audiophile/database/helper"
+	"Audiophile/models"
+	"Audiophile/utilities"
+	"database/sql"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// brandWriteError answers the errors a client can cause when saving a brand, it returns false for
+// every other error
+func brandWriteError(w http.ResponseWriter, err error) bool {
+	var message string
+	switch {
+	case utilities.IsUniqueViolation(err):
+		w.WriteHeader(http.StatusConflict)
+		message = "ERROR: slug is already used by another brand"
+	case utilities.IsForeignKeyViolation(err):
+		w.WriteHeader(http.StatusBadRequest)
+		message = "ERROR: logo image does not exist"
+	default:
+		return false
+	}
+	_, err = w.Write([]byte(message))
+	if err != nil {
+		return true
+	}
+	return true
+}
+
+func GetBrands(w http.ResponseWriter, r *http.Request) {
+	brands, err := helper.GetBrands(false)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("GetBrands: cannot get brands:%v", err)
+		return
+	}
+
+	err = utilities.Encoder(w, brands)
+	if err != nil {
+		logrus.Printf("GetBrands:%v", err)
+		return
+	}
+}
+
+// GetAllBrands lists the brands for the admin, archived ones included
+func GetAllBrands(w http.ResponseWriter, r *http.Request) {
+	brands, err := helper.GetBrands(true)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("GetAllBrands: cannot get brands:%v", err)
+		return
+	}
+
+	err = utilities.Encoder(w, brands)
+	if err != nil {
+		logrus.Printf("GetAllBrands:%v", err)
+		return
+	}
+}
+
+// GetBrandPage returns a brand with a page of its products, the product listing filters, sorts and
+// cursors all apply
+func GetBrandPage(w http.ResponseWriter, r *http.Request) {
+	brand, err := helper.FetchBrandBySlug(chi.URLParam(r, "slug"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("GetBrandPage: cannot get brand:%v", err)
+		return
+	}
+
+	filterCheck, err := productFilters(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("GetBrandPage: filterCheck error:%v", err)
+		_, err = w.Write([]byte("ERROR: " + err.Error()))
+		if err != nil {
+			return
+		}
+		return
+	}
+	filterCheck.BrandIDs = []int64{int64(brand.ID)}
+
+	products, err := helper.ViewProducts(filterCheck)
+	if err != nil {
+		if err == helper.ErrInvalidCursor {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("GetBrandPage: cannot get products:%v", err)
+		return
+	}
+
+	err = utilities.Encoder(w, models.BrandPage{Brand: brand, Products: products})
+	if err != nil {
+		logrus.Printf("GetBrandPage:%v", err)
+		return
+	}
+}
+
+func UpdateBrand(w http.ResponseWriter, r *http.Request) {
+	brandID, err := strconv.Atoi(chi.URLParam(r, "brandID"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("UpdateBrand: invalid brand id:%v", err)
+		return
+	}
+
+	var update models.BrandUpdate
+	decoderErr := utilities.Decoder(r, &update)
+	if decoderErr != nil || (update.BrandName != nil && strings.TrimSpace(*update.BrandName) == "") {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("Decoder error:%v", decoderErr)
+		return
+	}
+	if update.Slug != nil && !utilities.IsSlug(*update.Slug) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, err = w.Write([]byte("ERROR: slug may only contain lower case letters, digits and single dashes"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	updated, err := helper.UpdateBrand(brandID, update)
+	if err != nil {
+		if !brandWriteError(w, err) {
+			w.WriteHeader(http.StatusInternalServerError)
+			logrus.Printf("UpdateBrand:%v", err)
+		}
+		return
+	}
+	if !updated {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	message := "updated brand successfully"
+	err = utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("UpdateBrand:%v", err)
+		return
+	}
+}
+
+func ArchiveBrand(w http.ResponseWriter, r *http.Request) {
+	brandID, err := strconv.Atoi(chi.URLParam(r, "brandID"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("ArchiveBrand: invalid brand id:%v", err)
+		return
+	}
+
+	archived, err := helper.ArchiveBrand(brandID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ArchiveBrand:%v", err)
+		return
+	}
+	if !archived {
+		w.WriteHeader(http.StatusConflict)
+		_, err = w.Write([]byte("ERROR: brand does not exist, is archived or still has products"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	message := "archived brand successfully"
+	err = utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("ArchiveBrand:%v", err)
+		return
+	}
+}
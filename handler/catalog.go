@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"Audiophile/cache"
+	"Audiophile/database/helper"
+	"Audiophile/models"
+	"Audiophile/utilities"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSuggestionLimit = 5
+	maxSuggestionLimit     = 10
+	maxSuggestionPrefix    = 100
+)
+
+// suggestionCache answers the popular prefixes without the database, a catalog change shows up in the
+// suggestions once the cached entry expires
+var suggestionCache = cache.NewLRU(1000, time.Minute)
+
+// productFilters reads the catalog filters on top of the common ones, brand_id and category_id may
+// be repeated to select several values
+func productFilters(r *http.Request) (models.FiltersCheck, error) {
+	filterCheck, err := filters(r)
+	if err != nil {
+		return filterCheck, err
+	}
+	query := r.URL.Query()
+
+	for _, value := range query["brand_id"] {
+		brandID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return filterCheck, errors.New("invalid brand_id " + value)
+		}
+		filterCheck.BrandIDs = append(filterCheck.BrandIDs, brandID)
+	}
+
+	for _, value := range query["category_id"] {
+		categoryID, err := uuid.Parse(value)
+		if err != nil {
+			return filterCheck, errors.New("invalid category_id " + value)
+		}
+		filterCheck.CategoryIDs = append(filterCheck.CategoryIDs, categoryID.String())
+	}
+
+	filterCheck.MinPrice, err = priceParam(query.Get("min_price"))
+	if err != nil {
+		return filterCheck, errors.New("invalid min_price")
+	}
+	filterCheck.MaxPrice, err = priceParam(query.Get("max_price"))
+	if err != nil {
+		return filterCheck, errors.New("invalid max_price")
+	}
+	if filterCheck.MinPrice != nil && filterCheck.MaxPrice != nil && *filterCheck.MinPrice > *filterCheck.MaxPrice {
+		return filterCheck, errors.New("min_price is above max_price")
+	}
+
+	if inStock := query.Get("in_stock"); inStock != "" {
+		filterCheck.InStock, err = strconv.ParseBool(inStock)
+		if err != nil {
+			return filterCheck, errors.New("invalid in_stock")
+		}
+	}
+
+	filterCheck.Attributes, err = parseAttributeFilters(query)
+	if err != nil {
+		return filterCheck, err
+	}
+
+	filterCheck.Sort = query.Get("sort")
+	if filterCheck.Sort == "" {
+		filterCheck.Sort = models.SortName
+		if filterCheck.IsSearched {
+			filterCheck.Sort = models.SortRelevance
+		}
+	} else if !models.IsProductSort(filterCheck.Sort) {
+		return filterCheck, errors.New("invalid sort " + filterCheck.Sort)
+	}
+
+	err = cursorFilters(r, &filterCheck, filterCheck.Sort)
+	return filterCheck, err
+}
+
+func priceParam(value string) (*float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	price, err := strconv.ParseFloat(value, 64)
+	if err != nil || price < 0 || math.IsNaN(price) || math.IsInf(price, 0) {
+		return nil, errors.New("invalid price")
+	}
+	return &price, nil
+}
+
+func RateProduct(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("RateProduct:Context for ID:%v", ok)
+		return
+	}
+
+	productID, err := uuid.Parse(chi.URLParam(r, "productID"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("RateProduct: invalid product id:%v", err)
+		return
+	}
+
+	var rating models.ProductRating
+	decoderErr := utilities.Decoder(r, &rating)
+	if decoderErr != nil || rating.Rating < 1 || rating.Rating > 5 {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("Decoder error:%v", decoderErr)
+		_, err = w.Write([]byte("ERROR: rating must be between 1 and 5"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	purchased, err := helper.HasCompletedOrderOf(contextValues.ID, productID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("RateProduct:%v", err)
+		return
+	}
+	if !purchased {
+		w.WriteHeader(http.StatusForbidden)
+		_, err = w.Write([]byte("ERROR: only products from completed orders can be rated"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	err = helper.RateProduct(contextValues.ID, productID, rating.Rating)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("RateProduct:%v", err)
+		return
+	}
+
+	message := "rated product successfully"
+	err = utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("RateProduct:%v", err)
+		return
+	}
+}
+
+func GetSuggestions(w http.ResponseWriter, r *http.Request) {
+	prefix := strings.ToLower(strings.Join(strings.Fields(r.URL.Query().Get("q")), " "))
+	if prefix == "" || len(prefix) > maxSuggestionPrefix {
+		w.WriteHeader(http.StatusBadRequest)
+		_, err := w.Write([]byte("ERROR: q must be between 1 and 100 characters"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	limit := defaultSuggestionLimit
+	if strLimit := r.URL.Query().Get("limit"); strLimit != "" {
+		var err error
+		limit, err = strconv.Atoi(strLimit)
+		if err != nil || limit < 1 || limit > maxSuggestionLimit {
+			w.WriteHeader(http.StatusBadRequest)
+			_, err = w.Write([]byte("ERROR: limit must be between 1 and 10"))
+			if err != nil {
+				return
+			}
+			return
+		}
+	}
+
+	key := strconv.Itoa(limit) + ":" + prefix
+	if suggestions, ok := suggestionCache.Get(key); ok {
+		err := utilities.Encoder(w, suggestions)
+		if err != nil {
+			logrus.Printf("GetSuggestions:%v", err)
+		}
+		return
+	}
+
+	suggestions, err := helper.GetSuggestions(prefix, limit)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("GetSuggestions: cannot get suggestions:%v", err)
+		return
+	}
+	suggestionCache.Set(key, suggestions)
+
+	err = utilities.Encoder(w, suggestions)
+	if err != nil {
+		logrus.Printf("GetSuggestions:%v", err)
+		return
+	}
+}
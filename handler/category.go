@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"Audiophile/database"
+	"Audiophile/database/helper"
+	"Audiophile/models"
+	"Audiophile/utilities"
+	"database/sql"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+// categoryParam parses {categoryID} and checks the category exists, answering 400 or 404 otherwise
+func categoryParam(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	categoryID, err := uuid.Parse(chi.URLParam(r, "categoryID"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("categoryParam: invalid category id:%v", err)
+		return categoryID, false
+	}
+
+	_, err = helper.FetchCategory(categoryID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			return categoryID, false
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("categoryParam:%v", err)
+		return categoryID, false
+	}
+	return categoryID, true
+}
+
+func GetCategories(w http.ResponseWriter, r *http.Request) {
+	categories, err := helper.GetCategoryTree()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("GetCategories: cannot get categories:%v", err)
+		return
+	}
+
+	err = utilities.Encoder(w, categories)
+	if err != nil {
+		logrus.Printf("GetCategories:%v", err)
+		return
+	}
+}
+
+func RenameCategory(w http.ResponseWriter, r *http.Request) {
+	categoryID, ok := categoryParam(w, r)
+	if !ok {
+		return
+	}
+
+	var category models.Categories
+	decoderErr := utilities.Decoder(r, &category)
+	if decoderErr != nil || strings.TrimSpace(category.Name) == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("Decoder error:%v", decoderErr)
+		return
+	}
+
+	renamed, err := helper.RenameCategory(categoryID, category.Name)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("RenameCategory:%v", err)
+		return
+	}
+	if !renamed {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	message := "renamed category successfully"
+	err = utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("RenameCategory:%v", err)
+		return
+	}
+}
+
+func MoveCategory(w http.ResponseWriter, r *http.Request) {
+	categoryID, ok := categoryParam(w, r)
+	if !ok {
+		return
+	}
+
+	var move models.CategoryMove
+	decoderErr := utilities.Decoder(r, &move)
+	if decoderErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("Decoder error:%v", decoderErr)
+		return
+	}
+
+	moved := false
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var err error
+		moved, err = helper.MoveCategory(categoryID, move.ParentID, tx)
+		return err
+	})
+	if txErr != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("MoveCategory:%v", txErr)
+		return
+	}
+	if !moved {
+		w.WriteHeader(http.StatusBadRequest)
+		_, err := w.Write([]byte("ERROR: parent category does not exist, is inside the category or defines one of its attribute keys"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	message := "moved category successfully"
+	err := utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("MoveCategory:%v", err)
+		return
+	}
+}
+
+func ArchiveCategory(w http.ResponseWriter, r *http.Request) {
+	categoryID, ok := categoryParam(w, r)
+	if !ok {
+		return
+	}
+
+	archived, err := helper.ArchiveCategory(categoryID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ArchiveCategory:%v", err)
+		return
+	}
+	if !archived {
+		w.WriteHeader(http.StatusConflict)
+		_, err = w.Write([]byte("ERROR: category still has products or subcategories"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	message := "archived category successfully"
+	err = utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("ArchiveCategory:%v", err)
+		return
+	}
+}
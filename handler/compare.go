@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"Audiophile/database/helper"
+	"Audiophile/models"
+	"Audiophile/utilities"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// comparisonRows lines the values of the products up row by row, first price, brand and stock and
+// then every spec attribute any of them has
+func comparisonRows(products []models.ProductDetail) []models.ComparisonRow {
+	rows := []models.ComparisonRow{
+		{Key: "price", Name: "Price"},
+		{Key: "brand", Name: "Brand"},
+		{Key: "stock", Name: "Stock"},
+	}
+	for _, product := range products {
+		var brand interface{}
+		if product.Brand.ID != nil {
+			brand = product.Brand.Name
+		}
+		rows[0].Values = append(rows[0].Values, product.Price)
+		rows[1].Values = append(rows[1].Values, brand)
+		rows[2].Values = append(rows[2].Values, product.StockStatus)
+	}
+
+	byKey := make(map[string]int)
+	for i, product := range products {
+		for _, attribute := range product.Attributes {
+			row, ok := byKey[attribute.Key]
+			if !ok {
+				row = len(rows)
+				byKey[attribute.Key] = row
+				rows = append(rows, models.ComparisonRow{
+					Key:    attribute.Key,
+					Name:   attribute.Name,
+					Unit:   attribute.Unit,
+					Values: make([]interface{}, len(products)),
+				})
+			}
+			rows[row].Values[i] = attribute.Value
+		}
+	}
+
+	for i := range rows {
+		rows[i].Differs = differs(rows[i].Values)
+	}
+	return rows
+}
+
+// differs compares the values by their json form, which is what the client sees
+func differs(values []interface{}) bool {
+	var first []byte
+	for i, value := range values {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return true
+		}
+		if i == 0 {
+			first = encoded
+			continue
+		}
+		if string(encoded) != string(first) {
+			return true
+		}
+	}
+	return false
+}
+
+// CompareProducts takes the products as repeated id query parameters, in the order they are shown
+func CompareProducts(w http.ResponseWriter, r *http.Request) {
+	ids := r.URL.Query()["id"]
+	if len(ids) < models.MinCompareProducts || len(ids) > models.MaxCompareProducts {
+		w.WriteHeader(http.StatusBadRequest)
+		_, err := w.Write([]byte(fmt.Sprintf("ERROR: compare between %d and %d products", models.MinCompareProducts, models.MaxCompareProducts)))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	seen := make(map[uuid.UUID]bool, len(ids))
+	products := make([]models.ProductDetail, 0, len(ids))
+	for _, id := range ids {
+		productID, err := uuid.Parse(id)
+		if err != nil || seen[productID] {
+			w.WriteHeader(http.StatusBadRequest)
+			_, err = w.Write([]byte("ERROR: invalid or repeated product id " + id))
+			if err != nil {
+				return
+			}
+			return
+		}
+		seen[productID] = true
+
+		product, err := helper.FetchProduct(productID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				w.WriteHeader(http.StatusNotFound)
+				_, err = w.Write([]byte("ERROR: product " + id + " does not exist"))
+				if err != nil {
+					return
+				}
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			logrus.Printf("CompareProducts: cannot get product:%v", err)
+			return
+		}
+
+		product.Attributes, err = helper.GetProductAttributes(productID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			logrus.Printf("CompareProducts: cannot get product attributes:%v", err)
+			return
+		}
+		products = append(products, product)
+	}
+
+	comparison := models.Comparison{
+		Products: make([]models.ComparedProduct, 0, len(products)),
+		Rows:     comparisonRows(products),
+	}
+	for _, product := range products {
+		comparison.Products = append(comparison.Products, models.ComparedProduct{ID: product.ID, Name: product.Name, Images: product.Images})
+	}
+
+	err := utilities.Encoder(w, comparison)
+	if err != nil {
+		logrus.Printf("CompareProducts:%v", err)
+		return
+	}
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"Audiophile/database"
+	"Audiophile/database/helper"
+	"Audiophile/identity"
+	"Audiophile/models"
+	"Audiophile/utilities"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// LinkIdentity attaches an identity of an external provider to the logged-in account so it can be used to log in
+func LinkIdentity(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("LinkIdentity:Context for ID:%v", ok)
+		return
+	}
+
+	var request models.LinkIdentityRequest
+	decoderErr := utilities.Decoder(r, &request)
+	if decoderErr != nil || request.Provider == "" || request.Token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("Decoder error:%v", decoderErr)
+		return
+	}
+
+	provider, err := identity.Get(request.Provider)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("LinkIdentity:%v", err)
+		return
+	}
+
+	externalIdentity, err := provider.Verify(r.Context(), request.Token)
+	if err != nil {
+		if err == identity.ErrInvalidToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			logrus.Printf("LinkIdentity:cannot verify token:%v", err)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("LinkIdentity:cannot verify token:%v", err)
+		return
+	}
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		return helper.LinkIdentity(contextValues.ID, externalIdentity, tx)
+	})
+	if txErr != nil {
+		if utilities.IsUniqueViolation(txErr) {
+			w.WriteHeader(http.StatusConflict)
+			_, err = w.Write([]byte("ERROR: this identity is already linked to an account"))
+			if err != nil {
+				return
+			}
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("LinkIdentity: cannot link identity:%v", txErr)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	message := "linked identity successfully"
+	err = utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("LinkIdentity:%v", err)
+		return
+	}
+}
+
+func GetIdentities(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("GetIdentities:Context for ID:%v", ok)
+		return
+	}
+
+	identities, err := helper.GetUserIdentities(contextValues.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("GetIdentities: cannot get identities:%v", err)
+		return
+	}
+
+	err = utilities.Encoder(w, identities)
+	if err != nil {
+		logrus.Printf("GetIdentities:%v", err)
+		return
+	}
+}
+
+// UnlinkIdentity removes a linked identity, the last one of an account without a password is kept
+// so the user is never locked out
+func UnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("UnlinkIdentity:Context for ID:%v", ok)
+		return
+	}
+
+	identityID, err := uuid.Parse(chi.URLParam(r, "identityID"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("UnlinkIdentity: invalid identity id:%v", err)
+		return
+	}
+
+	unlinked, err := helper.UnlinkIdentity(contextValues.ID, identityID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("UnlinkIdentity: cannot unlink identity:%v", err)
+		return
+	}
+	if !unlinked {
+		w.WriteHeader(http.StatusConflict)
+		_, err = w.Write([]byte("ERROR: identity not found or it is the only way left to log in"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	message := "unlinked identity successfully"
+	err = utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("UnlinkIdentity:%v", err)
+		return
+	}
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"Audiophile/database"
+	"Audiophile/database/helper"
+	"Audiophile/models"
+	"Audiophile/signing"
+	"Audiophile/utilities"
+	"database/sql"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// impersonationDuration is deliberately short, an impersonation session cannot be refreshed
+const impersonationDuration = 15 * time.Minute
+
+// ImpersonateUser gives an admin a read only token to see the shop as a customer does, staff
+// accounts cannot be impersonated so it never grants more than the admin already has
+func ImpersonateUser(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ImpersonateUser:Context for ID:%v", ok)
+		return
+	}
+	userID, ok := targetUser(w, r, contextValues)
+	if !ok {
+		return
+	}
+
+	var request models.ImpersonationRequest
+	decoderErr := utilities.Decoder(r, &request)
+	request.Reason = strings.TrimSpace(request.Reason)
+	if decoderErr != nil || request.Reason == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("Decoder error:%v", decoderErr)
+		_, err := w.Write([]byte("ERROR: a reason is required"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	status, err := helper.FetchAccountStatus(userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ImpersonateUser: cannot get account status:%v", err)
+		return
+	}
+	if status.Suspended {
+		w.WriteHeader(http.StatusConflict)
+		_, err = w.Write([]byte("ERROR: account is suspended"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	permissions, err := helper.FetchUserPermissions(userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ImpersonateUser: cannot get permissions:%v", err)
+		return
+	}
+	if len(permissions) > 0 {
+		w.WriteHeader(http.StatusForbidden)
+		_, err = w.Write([]byte("ERROR: staff accounts cannot be impersonated"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	device := models.SessionDevice{
+		Role:       string(models.UserRoleUser),
+		DeviceName: "impersonation",
+		UserAgent:  r.UserAgent(),
+		IPAddress:  utilities.ClientIP(r),
+	}
+
+	var sessionID uuid.UUID
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		sessionID, err = helper.CreateImpersonationSession(userID, contextValues.ID, device, impersonationDuration, tx)
+		if err != nil {
+			return err
+		}
+		return helper.RecordAdminAction(contextValues.ID, models.AuditUserImpersonated, userID, map[string]interface{}{
+			"reason":    request.Reason,
+			"sessionId": sessionID,
+		}, tx)
+	})
+	if txErr != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ImpersonateUser:%v", txErr)
+		return
+	}
+
+	expiresAt := time.Now().Add(impersonationDuration)
+	impersonatorID := contextValues.ID
+	claims := &models.Claims{
+		ID:             userID,
+		Role:           string(models.UserRoleUser),
+		ImpersonatorID: &impersonatorID,
+		StandardClaims: jwt.StandardClaims{
+			Id:        sessionID.String(),
+			ExpiresAt: expiresAt.Unix(),
+		},
+	}
+	tokenString, err := signing.Keys.Sign(claims)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("TokenString: cannot create token string:%v", err)
+		return
+	}
+
+	userOutboundData := make(map[string]interface{})
+	userOutboundData["token"] = tokenString
+	userOutboundData["impersonating"] = userID
+	userOutboundData["impersonatorId"] = impersonatorID
+	userOutboundData["expiresAt"] = expiresAt.UTC()
+
+	err = utilities.Encoder(w, userOutboundData)
+	if err != nil {
+		logrus.Printf("ImpersonateUser:%v", err)
+		return
+	}
+}
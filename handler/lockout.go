@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"Audiophile/lockout"
+	"Audiophile/utilities"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func writeTooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	w.WriteHeader(http.StatusTooManyRequests)
+	_, err := w.Write([]byte(fmt.Sprintf("ERROR: too many attempts, try again in %d seconds", seconds)))
+	if err != nil {
+		return
+	}
+}
+
+// checkLockout answers 429 and returns true when any of the keys is currently locked out
+func checkLockout(w http.ResponseWriter, keys ...lockout.Key) bool {
+	retryAfter, err := lockout.Default.RetryAfter(keys...)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("checkLockout: cannot get lockout:%v", err)
+		return true
+	}
+	if retryAfter > 0 {
+		writeTooManyRequests(w, retryAfter)
+		return true
+	}
+	return false
+}
+
+// recordLoginFailure counts a failed attempt and answers 429 and returns true when it caused a lockout,
+// otherwise the caller writes its own error
+func recordLoginFailure(w http.ResponseWriter, keys ...lockout.Key) bool {
+	retryAfter, err := lockout.Default.Fail(keys...)
+	if err != nil {
+		logrus.Printf("recordLoginFailure: cannot record failure:%v", err)
+		return false
+	}
+	if retryAfter > 0 {
+		writeTooManyRequests(w, retryAfter)
+		return true
+	}
+	return false
+}
+
+func GetLockouts(w http.ResponseWriter, r *http.Request) {
+	attempts, err := lockout.Default.Store.List()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("GetLockouts: cannot get lockouts:%v", err)
+		return
+	}
+
+	err = utilities.Encoder(w, attempts)
+	if err != nil {
+		logrus.Printf("GetLockouts:%v", err)
+		return
+	}
+}
+
+func ClearLockout(w http.ResponseWriter, r *http.Request) {
+	kind := r.URL.Query().Get("kind")
+	value := r.URL.Query().Get("value")
+	if kind == "" || value == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("ClearLockout: kind and value are required")
+		return
+	}
+
+	err := lockout.Default.Store.Clear(kind, value)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ClearLockout: cannot clear lockout:%v", err)
+		return
+	}
+
+	message := "cleared lockout successfully"
+	err = utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("ClearLockout:%v", err)
+		return
+	}
+}
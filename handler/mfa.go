@@ -0,0 +1,463 @@
+package handler
+
+import (
+	"Audiophile/database"
+	"Audiophile/database/helper"
+	"Audiophile/lockout"
+	"Audiophile/models"
+	"Audiophile/signing"
+	"Audiophile/totp"
+	"Audiophile/utilities"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	mfaPendingDuration = 5 * time.Minute
+	mfaMaxAttempts     = 5
+	totpIssuer         = "Audiophile"
+	recoveryCodeCount  = 10
+	recoveryCodeSize   = 5
+)
+
+// completeLogin finishes a login whose first factor has been checked, accounts with TOTP enabled get a
+// short lived mfa pending token instead of a session
+func completeLogin(w http.ResponseWriter, r *http.Request, userID uuid.UUID, role, deviceName string) {
+	status, err := helper.FetchAccountStatus(userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("completeLogin: cannot get account status:%v", err)
+		return
+	}
+	if status.Suspended {
+		w.WriteHeader(http.StatusForbidden)
+		_, err = w.Write([]byte("ERROR: account is suspended"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	totpDetails, err := helper.FetchTOTP(userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("completeLogin: cannot get totp details:%v", err)
+		return
+	}
+
+	if totpDetails.Enabled {
+		expiresAt := time.Now().Add(mfaPendingDuration)
+		challengeID, err := helper.CreateMFAChallenge(userID, expiresAt)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			logrus.Printf("completeLogin: cannot create mfa challenge:%v", err)
+			return
+		}
+
+		claims := &models.MFAPendingClaims{
+			ID:         userID,
+			Role:       role,
+			DeviceName: deviceName,
+			Purpose:    models.PurposeMFAPending,
+			StandardClaims: jwt.StandardClaims{
+				Id:        challengeID.String(),
+				ExpiresAt: expiresAt.Unix(),
+			},
+		}
+		mfaToken, err := signing.Keys.Sign(claims)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			logrus.Printf("TokenString: cannot create token string:%v", err)
+			return
+		}
+
+		userOutboundData := make(map[string]interface{})
+		userOutboundData["mfaRequired"] = true
+		userOutboundData["mfaToken"] = mfaToken
+
+		err = utilities.Encoder(w, userOutboundData)
+		if err != nil {
+			logrus.Printf("Login: Not able to login:%v", err)
+		}
+		return
+	}
+
+	userOutboundData, err := startSession(userID, role, deviceName, false, r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("CreateSession: cannot create session:%v", err)
+		return
+	}
+
+	err = utilities.Encoder(w, userOutboundData)
+	if err != nil {
+		logrus.Printf("Login: Not able to login:%v", err)
+		return
+	}
+}
+
+// checkTOTPCode validates a code against an enabled enrollment and records it so it cannot be replayed
+func checkTOTPCode(userID uuid.UUID, totpDetails models.TOTPDetails, code string) (bool, error) {
+	step, ok := totp.Validate(totpDetails.Secret, code, time.Now(), totpDetails.LastUsedStep)
+	if !ok {
+		return false, nil
+	}
+	return helper.UseTOTPStep(userID, step)
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
+
+func generateRecoveryCodes() (codes, codeHashes []string, err error) {
+	codes = make([]string, 0, recoveryCodeCount)
+	codeHashes = make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, recoveryCodeSize)
+		if _, err = rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		code := hex.EncodeToString(buf)
+		codes = append(codes, code[:recoveryCodeSize]+"-"+code[recoveryCodeSize:])
+		codeHashes = append(codeHashes, utilities.HashToken(code))
+	}
+	return codes, codeHashes, nil
+}
+
+func LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var request models.MFALogin
+	decoderErr := utilities.Decoder(r, &request)
+	if decoderErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("Decoder error:%v", decoderErr)
+		return
+	}
+
+	claims := models.MFAPendingClaims{}
+	tkn, err := jwt.ParseWithClaims(request.MFAToken, &claims, signing.Keys.Keyfunc)
+	if err != nil || !tkn.Valid || claims.Purpose != models.PurposeMFAPending {
+		w.WriteHeader(http.StatusUnauthorized)
+		logrus.Printf("LoginMFA: invalid mfa token:%v", err)
+		return
+	}
+	challengeID, err := uuid.Parse(claims.Id)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		logrus.Printf("LoginMFA: mfa token has no challenge:%v", err)
+		return
+	}
+
+	// the user key holds the account back however many addresses or mfa tokens the codes are tried from
+	ipKey := lockout.Key{Kind: lockout.KindIP, Value: utilities.ClientIP(r)}
+	userKey := lockout.Key{Kind: lockout.KindUser, Value: claims.ID.String()}
+	if checkLockout(w, ipKey, userKey) {
+		return
+	}
+
+	attempted, err := helper.UseMFAChallengeAttempt(challengeID, claims.ID, mfaMaxAttempts)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("LoginMFA: cannot count attempt:%v", err)
+		return
+	}
+	if !attempted {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, err = w.Write([]byte("ERROR: mfa token has expired or too many attempts were made, log in again"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	totpDetails, err := helper.FetchTOTP(claims.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("LoginMFA: cannot get totp details:%v", err)
+		return
+	}
+	if !totpDetails.Enabled {
+		w.WriteHeader(http.StatusUnauthorized)
+		logrus.Printf("LoginMFA: totp is not enabled")
+		return
+	}
+
+	var verified bool
+	if request.RecoveryCode != "" {
+		verified, err = helper.UseRecoveryCode(claims.ID, utilities.HashToken(normalizeRecoveryCode(request.RecoveryCode)))
+	} else {
+		verified, err = checkTOTPCode(claims.ID, totpDetails, request.Code)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("LoginMFA: cannot verify code:%v", err)
+		return
+	}
+	if !verified {
+		if recordLoginFailure(w, ipKey, userKey) {
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		_, err = w.Write([]byte("ERROR: Wrong code"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	completed, err := helper.CompleteMFAChallenge(challengeID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("LoginMFA: cannot complete challenge:%v", err)
+		return
+	}
+	if !completed {
+		w.WriteHeader(http.StatusUnauthorized)
+		logrus.Printf("LoginMFA: mfa token was already used")
+		return
+	}
+
+	err = lockout.Default.Succeed(userKey)
+	if err != nil {
+		logrus.Printf("LoginMFA: cannot clear failed attempts:%v", err)
+	}
+
+	userOutboundData, err := startSession(claims.ID, claims.Role, claims.DeviceName, true, r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("CreateSession: cannot create session:%v", err)
+		return
+	}
+
+	err = utilities.Encoder(w, userOutboundData)
+	if err != nil {
+		logrus.Printf("LoginMFA:%v", err)
+		return
+	}
+}
+
+func EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("EnrollTOTP:Context for ID:%v", ok)
+		return
+	}
+
+	totpDetails, err := helper.FetchTOTP(contextValues.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("EnrollTOTP: cannot get totp details:%v", err)
+		return
+	}
+	if totpDetails.Enabled {
+		w.WriteHeader(http.StatusConflict)
+		_, err = w.Write([]byte("ERROR: two-factor authentication is already enabled"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	email, err := helper.FetchEmail(contextValues.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("EnrollTOTP: cannot get email:%v", err)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("EnrollTOTP: cannot generate secret:%v", err)
+		return
+	}
+
+	err = helper.SavePendingTOTP(contextValues.ID, secret)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("EnrollTOTP: cannot save secret:%v", err)
+		return
+	}
+
+	userOutboundData := make(map[string]interface{})
+	userOutboundData["secret"] = secret
+	userOutboundData["provisioningUri"] = totp.ProvisioningURI(totpIssuer, email, secret)
+
+	err = utilities.Encoder(w, userOutboundData)
+	if err != nil {
+		logrus.Printf("EnrollTOTP:%v", err)
+		return
+	}
+}
+
+// ConfirmTOTP activates a pending enrollment once the user proves their app produces valid codes and
+// hands out the recovery codes, they are only ever shown in this response
+func ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ConfirmTOTP:Context for ID:%v", ok)
+		return
+	}
+
+	var request models.MFACode
+	decoderErr := utilities.Decoder(r, &request)
+	if decoderErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("Decoder error:%v", decoderErr)
+		return
+	}
+
+	totpDetails, err := helper.FetchTOTP(contextValues.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ConfirmTOTP: cannot get totp details:%v", err)
+		return
+	}
+	if totpDetails.Secret == "" || totpDetails.Enabled {
+		w.WriteHeader(http.StatusConflict)
+		_, err = w.Write([]byte("ERROR: no pending two-factor enrollment"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	step, valid := totp.Validate(totpDetails.Secret, request.Code, time.Now(), totpDetails.LastUsedStep)
+	if !valid {
+		w.WriteHeader(http.StatusBadRequest)
+		_, err = w.Write([]byte("ERROR: Wrong code"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	codes, codeHashes, err := generateRecoveryCodes()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ConfirmTOTP: cannot generate recovery codes:%v", err)
+		return
+	}
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		err := helper.EnableTOTP(contextValues.ID, step, tx)
+		if err != nil {
+			return err
+		}
+		err = helper.DeleteRecoveryCodes(contextValues.ID, tx)
+		if err != nil {
+			return err
+		}
+		return helper.AddRecoveryCodes(contextValues.ID, codeHashes, tx)
+	})
+	if txErr != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ConfirmTOTP:%v", txErr)
+		return
+	}
+
+	userOutboundData := make(map[string]interface{})
+	userOutboundData["recoveryCodes"] = codes
+
+	err = utilities.Encoder(w, userOutboundData)
+	if err != nil {
+		logrus.Printf("ConfirmTOTP:%v", err)
+		return
+	}
+}
+
+func DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("DisableTOTP:Context for ID:%v", ok)
+		return
+	}
+
+	var request models.MFACode
+	decoderErr := utilities.Decoder(r, &request)
+	if decoderErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("Decoder error:%v", decoderErr)
+		return
+	}
+
+	totpDetails, err := helper.FetchTOTP(contextValues.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("DisableTOTP: cannot get totp details:%v", err)
+		return
+	}
+	if !totpDetails.Enabled {
+		w.WriteHeader(http.StatusConflict)
+		_, err = w.Write([]byte("ERROR: two-factor authentication is not enabled"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	verified, err := checkTOTPCode(contextValues.ID, totpDetails, request.Code)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("DisableTOTP: cannot verify code:%v", err)
+		return
+	}
+	if !verified {
+		w.WriteHeader(http.StatusBadRequest)
+		_, err = w.Write([]byte("ERROR: Wrong code"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		return helper.DeleteTOTP(contextValues.ID, tx)
+	})
+	if txErr != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("DisableTOTP:%v", txErr)
+		return
+	}
+
+	message := "Two-factor authentication disabled"
+	err = utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("DisableTOTP:%v", err)
+		return
+	}
+}
+
+func SetMFAPolicy(w http.ResponseWriter, r *http.Request) {
+	var policy models.MFAPolicy
+	decoderErr := utilities.Decoder(r, &policy)
+	if decoderErr != nil || policy.Role == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("Decoder error:%v", decoderErr)
+		return
+	}
+
+	err := helper.SetMFAPolicy(policy)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("SetMFAPolicy: cannot set policy:%v", err)
+		return
+	}
+
+	message := "Updated two-factor policy successfully"
+	err = utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("SetMFAPolicy:%v", err)
+		return
+	}
+}
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"Audiophile/database"
+	"Audiophile/database/helper"
+	"Audiophile/lockout"
+	"Audiophile/mailer"
+	"Audiophile/models"
+	"Audiophile/utilities"
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	passwordResetDuration  = 30 * time.Minute
+	passwordResetTokenSize = 32
+	minPasswordLength      = 8
+)
+
+// RequestPasswordReset mails a single use reset link, it answers the same way whether or not
+// the email belongs to an account so that it cannot be used to discover registered addresses
+func RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var request models.PasswordResetRequest
+	decoderErr := utilities.Decoder(r, &request)
+	if decoderErr != nil || request.Email == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("Decoder error:%v", decoderErr)
+		return
+	}
+
+	email := strings.ToLower(request.Email)
+	message := "If the email is registered, a password reset link has been sent"
+
+	// every request counts whether or not the email is registered, so the limit gives nothing away
+	keys := []lockout.Key{
+		{Kind: lockout.KindResetEmail, Value: email},
+		{Kind: lockout.KindResetIP, Value: utilities.ClientIP(r)},
+	}
+	if checkLockout(w, keys...) {
+		return
+	}
+	_, err := lockout.Default.Fail(keys...)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("RequestPasswordReset: cannot count request:%v", err)
+		return
+	}
+
+	userID, err := helper.FetchUserIDByEmail(email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = utilities.Encoder(w, message)
+			if err != nil {
+				logrus.Printf("RequestPasswordReset:%v", err)
+			}
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("RequestPasswordReset: cannot get user:%v", err)
+		return
+	}
+
+	token, err := utilities.GenerateToken(passwordResetTokenSize)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("RequestPasswordReset: cannot generate token:%v", err)
+		return
+	}
+
+	err = helper.CreatePasswordResetToken(userID, utilities.HashToken(token), time.Now().Add(passwordResetDuration))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("RequestPasswordReset: cannot store token:%v", err)
+		return
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", os.Getenv("frontend_url"), url.QueryEscape(token))
+	body := fmt.Sprintf("We received a request to reset your Audiophile password.\n\nOpen the link below within %d minutes to choose a new password:\n%s\n\nIf you did not ask for this, you can ignore this email.", int(passwordResetDuration.Minutes()), link)
+	err = mailer.Default.Send(email, "Reset your Audiophile password", body)
+	if err != nil {
+		// failing here would tell that the email is registered, so the failure is only logged
+		logrus.Printf("RequestPasswordReset: cannot send mail:%v", err)
+	}
+
+	err = utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("RequestPasswordReset:%v", err)
+		return
+	}
+}
+
+func ConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var request models.PasswordResetConfirm
+	decoderErr := utilities.Decoder(r, &request)
+	if decoderErr != nil || request.Token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("Decoder error:%v", decoderErr)
+		return
+	}
+
+	if len(request.Password) < minPasswordLength {
+		w.WriteHeader(http.StatusBadRequest)
+		_, err := w.Write([]byte(fmt.Sprintf("ERROR: password must be at least %d characters", minPasswordLength)))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		userID, err := helper.ConsumePasswordResetToken(utilities.HashToken(request.Token), tx)
+		if err != nil {
+			return err
+		}
+		err = helper.UpdatePassword(userID, request.Password, tx)
+		if err != nil {
+			return err
+		}
+		err = helper.ExpirePasswordResetTokens(userID, tx)
+		if err != nil {
+			return err
+		}
+		return helper.RevokeAllSessions(userID, tx)
+	})
+	if txErr != nil {
+		if txErr == sql.ErrNoRows {
+			w.WriteHeader(http.StatusBadRequest)
+			_, err := w.Write([]byte("ERROR: reset link is invalid or has expired"))
+			if err != nil {
+				return
+			}
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ConfirmPasswordReset:%v", txErr)
+		return
+	}
+
+	message := "Password has been reset, please log in again"
+	err := utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("ConfirmPasswordReset:%v", err)
+		return
+	}
+}
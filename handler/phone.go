@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"Audiophile/database"
+	"Audiophile/database/helper"
+	"Audiophile/models"
+	"Audiophile/sms"
+	"Audiophile/utilities"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	otpDigits          = 6
+	otpDuration        = 10 * time.Minute
+	otpResendInterval  = time.Minute
+	otpSendWindow      = time.Hour
+	otpMaxSendsPerHour = 5
+	otpMaxAttempts     = 5
+)
+
+func generateOTP() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < otpDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", otpDigits, n), nil
+}
+
+// hashOTP ties the code to its user so equal codes of different users never share a hash
+func hashOTP(userID uuid.UUID, code string) string {
+	return utilities.HashToken(userID.String() + ":" + code)
+}
+
+// phoneRequiredForCOD tells whether cash on delivery needs a verified phone number, cod_requires_phone
+// switches it on but only while a sender is configured, otherwise nobody could verify
+func phoneRequiredForCOD() bool {
+	return os.Getenv("cod_requires_phone") == "true" && sms.Enabled()
+}
+
+// SendPhoneOTP texts a one time code to the phone number on the account, a new code can be
+// requested once a minute and at most otpMaxSendsPerHour times an hour
+func SendPhoneOTP(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("SendPhoneOTP:Context for ID:%v", ok)
+		return
+	}
+	if !sms.Enabled() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, err := w.Write([]byte("ERROR: phone verification is not available"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	status, err := helper.FetchPhoneStatus(contextValues.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("SendPhoneOTP: cannot get phone status:%v", err)
+		return
+	}
+	if status.PhoneNo == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, err = w.Write([]byte("ERROR: add a phone number to your profile first"))
+		if err != nil {
+			return
+		}
+		return
+	}
+	if status.Verified {
+		w.WriteHeader(http.StatusConflict)
+		_, err = w.Write([]byte("ERROR: phone number is already verified"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	stats, err := helper.FetchOTPSendStats(contextValues.ID, otpSendWindow)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("SendPhoneOTP: cannot get otp stats:%v", err)
+		return
+	}
+	if stats.LastSentAt != nil && time.Since(*stats.LastSentAt) < otpResendInterval {
+		writeTooManyRequests(w, otpResendInterval-time.Since(*stats.LastSentAt))
+		return
+	}
+	if stats.SentInWindow >= otpMaxSendsPerHour {
+		writeTooManyRequests(w, otpSendWindow)
+		return
+	}
+
+	code, err := generateOTP()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("SendPhoneOTP: cannot generate code:%v", err)
+		return
+	}
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		return helper.CreatePhoneOTP(contextValues.ID, status.PhoneNo, hashOTP(contextValues.ID, code), time.Now().Add(otpDuration), tx)
+	})
+	if txErr != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("SendPhoneOTP:%v", txErr)
+		return
+	}
+
+	err = sms.Default.Send(status.PhoneNo, fmt.Sprintf("Your Audiophile verification code is %s, it expires in %d minutes.", code, int(otpDuration.Minutes())))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("SendPhoneOTP: cannot send sms:%v", err)
+		return
+	}
+
+	message := "Verification code sent"
+	err = utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("SendPhoneOTP:%v", err)
+		return
+	}
+}
+
+func VerifyPhoneOTP(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("VerifyPhoneOTP:Context for ID:%v", ok)
+		return
+	}
+
+	var request models.PhoneOTPVerify
+	decoderErr := utilities.Decoder(r, &request)
+	code := strings.TrimSpace(request.Code)
+	if decoderErr != nil || len(code) != otpDigits {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("Decoder error:%v", decoderErr)
+		return
+	}
+	if _, err := strconv.Atoi(code); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	otp, err := helper.UsePhoneOTPAttempt(contextValues.ID, otpMaxAttempts)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusBadRequest)
+			_, err = w.Write([]byte("ERROR: code has expired or too many attempts were made, request a new one"))
+			if err != nil {
+				return
+			}
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("VerifyPhoneOTP: cannot get code:%v", err)
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(otp.CodeHash), []byte(hashOTP(contextValues.ID, code))) != 1 {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, err = w.Write([]byte(fmt.Sprintf("ERROR: wrong code, %d attempts left", otpMaxAttempts-otp.Attempts)))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	verified := false
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		verified, err = helper.VerifyPhone(contextValues.ID, otp.ID, otp.PhoneNo, tx)
+		return err
+	})
+	if txErr != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("VerifyPhoneOTP:%v", txErr)
+		return
+	}
+	if !verified {
+		w.WriteHeader(http.StatusBadRequest)
+		_, err = w.Write([]byte("ERROR: phone number has changed since the code was sent"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	message := "Phone number verified successfully"
+	err = utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("VerifyPhoneOTP:%v", err)
+		return
+	}
+}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"Audiophile/database"
+	"Audiophile/database/helper"
+	"Audiophile/lockout"
+	"Audiophile/models"
+	"Audiophile/utilities"
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+func collectDataExport(userID uuid.UUID) (models.DataExport, error) {
+	var err error
+	dataExport := models.DataExport{ExportedAt: time.Now().UTC()}
+
+	dataExport.Profile, err = helper.FetchProfile(userID)
+	if err != nil {
+		return dataExport, err
+	}
+	dataExport.Addresses, err = helper.GetExportAddresses(userID)
+	if err != nil {
+		return dataExport, err
+	}
+	dataExport.Carts, err = helper.GetExportCarts(userID)
+	if err != nil {
+		return dataExport, err
+	}
+	dataExport.Orders, err = helper.GetExportOrders(userID)
+	if err != nil {
+		return dataExport, err
+	}
+	dataExport.Payments, err = helper.GetExportPayments(userID)
+	if err != nil {
+		return dataExport, err
+	}
+	dataExport.Bills, err = helper.GetExportBills(userID)
+	return dataExport, err
+}
+
+// writeExportZIP writes every section of the export as its own json file inside a zip archive
+func writeExportZIP(w http.ResponseWriter, dataExport models.DataExport) error {
+	files := []struct {
+		name    string
+		content interface{}
+	}{
+		{"profile.json", dataExport.Profile},
+		{"addresses.json", dataExport.Addresses},
+		{"carts.json", dataExport.Carts},
+		{"orders.json", dataExport.Orders},
+		{"payments.json", dataExport.Payments},
+		{"bills.json", dataExport.Bills},
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=audiophile-export-%s.zip", dataExport.ExportedAt.Format("20060102")))
+
+	archive := zip.NewWriter(w)
+	for _, file := range files {
+		fileWriter, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: dataExport.ExportedAt})
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(fileWriter)
+		encoder.SetIndent("", "  ")
+		if err = encoder.Encode(file.content); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// ExportData hands the user everything stored about them, as one json document or, with
+// ?format=zip, as a zip of one json file per section
+func ExportData(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ExportData:Context for ID:%v", ok)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = models.ExportFormatJSON
+	}
+	if format != models.ExportFormatJSON && format != models.ExportFormatZIP {
+		w.WriteHeader(http.StatusBadRequest)
+		_, err := w.Write([]byte("ERROR: format must be json or zip"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	dataExport, err := collectDataExport(contextValues.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ExportData: cannot collect data:%v", err)
+		return
+	}
+
+	if format == models.ExportFormatZIP {
+		err = writeExportZIP(w, dataExport)
+		if err != nil {
+			logrus.Printf("ExportData: cannot write zip:%v", err)
+		}
+		return
+	}
+
+	err = utilities.Encoder(w, dataExport)
+	if err != nil {
+		logrus.Printf("ExportData:%v", err)
+		return
+	}
+}
+
+// DeleteAccount anonymises the account and logs it out everywhere, orders and bills are kept
+// for accounting but no longer point at anything personal
+func DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("DeleteAccount:Context for ID:%v", ok)
+		return
+	}
+
+	var request models.DeleteAccountRequest
+	decoderErr := utilities.Decoder(r, &request)
+	if decoderErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("Decoder error:%v", decoderErr)
+		return
+	}
+
+	if !confirmIdentity(w, r, contextValues.ID, request.Password, request.Provider, request.Token) {
+		return
+	}
+
+	email, err := helper.FetchEmail(contextValues.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("DeleteAccount: cannot get email:%v", err)
+		return
+	}
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		err := helper.AnonymiseUser(contextValues.ID, tx)
+		if err != nil {
+			return err
+		}
+		return helper.DeleteUserCredentials(contextValues.ID, tx)
+	})
+	if txErr != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("DeleteAccount:%v", txErr)
+		return
+	}
+
+	err = lockout.Default.Succeed(lockout.Key{Kind: lockout.KindEmail, Value: email})
+	if err != nil {
+		logrus.Printf("DeleteAccount: cannot clear login attempts:%v", err)
+	}
+
+	message := "Account deleted"
+	err = utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("DeleteAccount:%v", err)
+		return
+	}
+}
@@ -0,0 +1,420 @@
+package handler
+
+import (
+	"Audiophile/database"
+	"Audiophile/database/helper"
+	"Audiophile/identity"
+	"Audiophile/lockout"
+	"Audiophile/mailer"
+	"Audiophile/models"
+	"Audiophile/signing"
+	"Audiophile/utilities"
+	"database/sql"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const maxAge = 150
+
+// checkCurrentPassword reports whether password matches the one on the account, accounts created
+// through an identity provider have no password and never match
+func checkCurrentPassword(userID uuid.UUID, password string) (bool, error) {
+	hash, err := helper.FetchPasswordHash(userID)
+	if err != nil {
+		return false, err
+	}
+	if hash == "" {
+		return false, nil
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil, nil
+}
+
+// confirmIdentity makes the caller prove again that they own the account before a sensitive change,
+// with the password or, for accounts made through an identity provider, a new token of one of their
+// linked identities. Failures count towards the account's lockout so a stolen session cannot guess its
+// way through, it answers the request itself and returns false when the caller is not confirmed
+func confirmIdentity(w http.ResponseWriter, r *http.Request, userID uuid.UUID, password, providerName, token string) bool {
+	userKey := lockout.Key{Kind: lockout.KindUser, Value: userID.String()}
+	if checkLockout(w, userKey) {
+		return false
+	}
+
+	hash, err := helper.FetchPasswordHash(userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("confirmIdentity: cannot get password:%v", err)
+		return false
+	}
+
+	message := "ERROR: password is incorrect"
+	confirmed := false
+	if hash != "" {
+		confirmed = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	} else {
+		message = "ERROR: sign in with your identity provider again and send its provider and token"
+		confirmed, err = isLinkedIdentity(r, userID, providerName, token)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			logrus.Printf("confirmIdentity: cannot verify identity:%v", err)
+			return false
+		}
+	}
+	if confirmed {
+		return true
+	}
+
+	if recordLoginFailure(w, userKey) {
+		return false
+	}
+	w.WriteHeader(http.StatusUnauthorized)
+	_, err = w.Write([]byte(message))
+	if err != nil {
+		return false
+	}
+	return false
+}
+
+// isLinkedIdentity reports whether token is a valid token of the provider for an identity linked to the user
+func isLinkedIdentity(r *http.Request, userID uuid.UUID, providerName, token string) (bool, error) {
+	if providerName == "" || token == "" {
+		return false, nil
+	}
+	provider, err := identity.Get(providerName)
+	if err != nil {
+		return false, nil
+	}
+
+	externalIdentity, err := provider.Verify(r.Context(), token)
+	if err != nil {
+		if err == identity.ErrInvalidToken {
+			return false, nil
+		}
+		return false, err
+	}
+
+	identityUserID, err := helper.FetchIdentityUser(externalIdentity.Provider, externalIdentity.Subject)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	return identityUserID == userID, nil
+}
+
+func GetProfile(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("GetProfile:Context for ID:%v", ok)
+		return
+	}
+
+	profile, err := helper.FetchProfile(contextValues.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("GetProfile: cannot get profile:%v", err)
+		return
+	}
+
+	err = utilities.Encoder(w, profile)
+	if err != nil {
+		logrus.Printf("GetProfile:%v", err)
+		return
+	}
+}
+
+func UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("UpdateProfile:Context for ID:%v", ok)
+		return
+	}
+
+	var profileUpdate models.ProfileUpdate
+	decoderErr := utilities.Decoder(r, &profileUpdate)
+	if decoderErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("Decoder error:%v", decoderErr)
+		return
+	}
+
+	if profileUpdate.Name != nil {
+		name := strings.TrimSpace(*profileUpdate.Name)
+		profileUpdate.Name = &name
+	}
+	if profileUpdate.PhoneNo != nil {
+		phoneNo := strings.TrimSpace(*profileUpdate.PhoneNo)
+		profileUpdate.PhoneNo = &phoneNo
+	}
+	if (profileUpdate.Name != nil && *profileUpdate.Name == "") ||
+		(profileUpdate.PhoneNo != nil && *profileUpdate.PhoneNo == "") ||
+		(profileUpdate.Age != nil && (*profileUpdate.Age <= 0 || *profileUpdate.Age > maxAge)) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, err := w.Write([]byte("ERROR: name and phone number cannot be empty and age must be a valid number"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	err := helper.UpdateProfile(contextValues.ID, profileUpdate)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("UpdateProfile: cannot update profile:%v", err)
+		return
+	}
+
+	profile, err := helper.FetchProfile(contextValues.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("UpdateProfile: cannot get profile:%v", err)
+		return
+	}
+
+	err = utilities.Encoder(w, profile)
+	if err != nil {
+		logrus.Printf("UpdateProfile:%v", err)
+		return
+	}
+}
+
+// ChangePassword replaces the password after checking the current one and logs out every other device
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ChangePassword:Context for ID:%v", ok)
+		return
+	}
+
+	var request models.ChangePasswordRequest
+	decoderErr := utilities.Decoder(r, &request)
+	if decoderErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("Decoder error:%v", decoderErr)
+		return
+	}
+
+	if len(request.NewPassword) < minPasswordLength {
+		w.WriteHeader(http.StatusBadRequest)
+		_, err := w.Write([]byte(fmt.Sprintf("ERROR: password must be at least %d characters", minPasswordLength)))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	userKey := lockout.Key{Kind: lockout.KindUser, Value: contextValues.ID.String()}
+	if checkLockout(w, userKey) {
+		return
+	}
+	matches, err := checkCurrentPassword(contextValues.ID, request.CurrentPassword)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ChangePassword: cannot check password:%v", err)
+		return
+	}
+	if !matches {
+		if recordLoginFailure(w, userKey) {
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		_, err = w.Write([]byte("ERROR: current password is incorrect, accounts without a password can set one through password reset"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		err := helper.UpdatePassword(contextValues.ID, request.NewPassword, tx)
+		if err != nil {
+			return err
+		}
+		err = helper.ExpirePasswordResetTokens(contextValues.ID, tx)
+		if err != nil {
+			return err
+		}
+		return helper.RevokeOtherSessions(contextValues.ID, contextValues.SessionID, tx)
+	})
+	if txErr != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ChangePassword:%v", txErr)
+		return
+	}
+
+	message := "Password changed, other devices have been logged out"
+	err = utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("ChangePassword:%v", err)
+		return
+	}
+}
+
+// sendEmailChangeEmail mails the new address a signed link that moves the account over to it
+func sendEmailChangeEmail(userID uuid.UUID, previousEmail, email string) error {
+	claims := &models.EmailVerificationClaims{
+		ID:            userID,
+		Email:         email,
+		Purpose:       models.PurposeEmailChange,
+		PreviousEmail: previousEmail,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(emailVerificationDuration).Unix(),
+		},
+	}
+	token, err := signing.Keys.Sign(claims)
+	if err != nil {
+		logrus.Printf("sendEmailChangeEmail: cannot sign token:%v", err)
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email/change?token=%s", os.Getenv("frontend_url"), url.QueryEscape(token))
+	body := fmt.Sprintf("Someone asked to move an Audiophile account to this address.\n\nIf it was you, confirm it by opening the link below within %d hours:\n%s", int(emailVerificationDuration.Hours()), link)
+	return mailer.Default.Send(email, "Confirm your new Audiophile email", body)
+}
+
+// ChangeEmail starts an email change, the account keeps its current address until the link
+// mailed to the new one is opened
+func ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ChangeEmail:Context for ID:%v", ok)
+		return
+	}
+
+	var request models.ChangeEmailRequest
+	decoderErr := utilities.Decoder(r, &request)
+	if decoderErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("Decoder error:%v", decoderErr)
+		return
+	}
+
+	email := strings.ToLower(strings.TrimSpace(request.Email))
+	if _, err := mail.ParseAddress(email); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, err = w.Write([]byte("ERROR: email is not valid"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	if !confirmIdentity(w, r, contextValues.ID, request.Password, request.Provider, request.Token) {
+		return
+	}
+
+	status, err := helper.FetchEmailVerificationStatus(contextValues.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ChangeEmail: cannot get current email:%v", err)
+		return
+	}
+	if status.Email == email {
+		w.WriteHeader(http.StatusBadRequest)
+		_, err = w.Write([]byte("ERROR: this is already the email of the account"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	_, err = helper.FetchUserIDByEmail(email)
+	if err == nil {
+		w.WriteHeader(http.StatusConflict)
+		_, err = w.Write([]byte("ERROR: email is already in use"))
+		if err != nil {
+			return
+		}
+		return
+	}
+	if err != sql.ErrNoRows {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ChangeEmail: cannot check email:%v", err)
+		return
+	}
+
+	err = sendEmailChangeEmail(contextValues.ID, status.Email, email)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ChangeEmail: cannot send mail:%v", err)
+		return
+	}
+
+	err = mailer.Default.Send(status.Email, "Your Audiophile email is being changed",
+		fmt.Sprintf("A change of your account email to %s was requested. If this was not you, reset your password right away.", email))
+	if err != nil {
+		logrus.Printf("ChangeEmail: cannot notify current address:%v", err)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	message := "Confirmation sent to the new email"
+	err = utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("ChangeEmail:%v", err)
+		return
+	}
+}
+
+func ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	claims := models.EmailVerificationClaims{}
+	tkn, err := jwt.ParseWithClaims(token, &claims, signing.Keys.Keyfunc)
+	if err != nil || !tkn.Valid || claims.Purpose != models.PurposeEmailChange {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("ConfirmEmailChange: invalid token:%v", err)
+		_, err = w.Write([]byte("ERROR: confirmation link is invalid or has expired"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	changed, err := helper.ChangeEmail(claims.ID, claims.PreviousEmail, claims.Email)
+	if err != nil {
+		if utilities.IsUniqueViolation(err) {
+			w.WriteHeader(http.StatusConflict)
+			_, err = w.Write([]byte("ERROR: email is already in use"))
+			if err != nil {
+				return
+			}
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ConfirmEmailChange: cannot change email:%v", err)
+		return
+	}
+	if !changed {
+		w.WriteHeader(http.StatusBadRequest)
+		_, err = w.Write([]byte("ERROR: the account email has changed since this link was sent"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	message := "Email changed successfully"
+	err = utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("ConfirmEmailChange:%v", err)
+		return
+	}
+}
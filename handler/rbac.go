@@ -0,0 +1,245 @@
+package handler
+
+import (
+	"Audiophile/database"
+	"Audiophile/database/helper"
+	"Audiophile/models"
+	"Audiophile/utilities"
+	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// validatePermissions answers 400 and returns false when a permission is not one of the known ones
+func validatePermissions(w http.ResponseWriter, permissions []string) bool {
+	known, err := helper.GetPermissions()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("validatePermissions: cannot get permissions:%v", err)
+		return false
+	}
+
+	knownSet := make(map[string]bool, len(known))
+	for _, permission := range known {
+		knownSet[permission.Name] = true
+	}
+
+	for _, permission := range permissions {
+		if !knownSet[permission] {
+			w.WriteHeader(http.StatusBadRequest)
+			_, err = w.Write([]byte("ERROR: unknown permission " + permission))
+			if err != nil {
+				return false
+			}
+			return false
+		}
+	}
+	return true
+}
+
+func GetPermissions(w http.ResponseWriter, r *http.Request) {
+	permissions, err := helper.GetPermissions()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("GetPermissions: cannot get permissions:%v", err)
+		return
+	}
+
+	err = utilities.Encoder(w, permissions)
+	if err != nil {
+		logrus.Printf("GetPermissions:%v", err)
+		return
+	}
+}
+
+func GetRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := helper.GetRoleDefinitions()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("GetRoles: cannot get roles:%v", err)
+		return
+	}
+
+	err = utilities.Encoder(w, roles)
+	if err != nil {
+		logrus.Printf("GetRoles:%v", err)
+		return
+	}
+}
+
+func AddRole(w http.ResponseWriter, r *http.Request) {
+	var role models.RoleDefinition
+	decoderErr := utilities.Decoder(r, &role)
+	if decoderErr != nil || role.Name == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("Decoder error:%v", decoderErr)
+		return
+	}
+
+	if !validatePermissions(w, role.Permissions) {
+		return
+	}
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		err := helper.AddRoleDefinition(role, tx)
+		if err != nil {
+			return err
+		}
+		return helper.SetRolePermissions(role.Name, role.Permissions, tx)
+	})
+	if txErr != nil {
+		if utilities.IsUniqueViolation(txErr) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("AddRole:%v", txErr)
+		return
+	}
+
+	message := "Successfully added role"
+	err := utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("AddRole:%v", err)
+		return
+	}
+}
+
+func UpdateRole(w http.ResponseWriter, r *http.Request) {
+	var role models.RoleDefinition
+	decoderErr := utilities.Decoder(r, &role)
+	if decoderErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("Decoder error:%v", decoderErr)
+		return
+	}
+	role.Name = chi.URLParam(r, "role")
+
+	if !validatePermissions(w, role.Permissions) {
+		return
+	}
+
+	found := false
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var err error
+		found, err = helper.UpdateRoleDefinition(role, tx)
+		if err != nil || !found {
+			return err
+		}
+		return helper.SetRolePermissions(role.Name, role.Permissions, tx)
+	})
+	if txErr != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("UpdateRole:%v", txErr)
+		return
+	}
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	message := "updated role successfully"
+	err := utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("UpdateRole:%v", err)
+		return
+	}
+}
+
+func DeleteRole(w http.ResponseWriter, r *http.Request) {
+	role := chi.URLParam(r, "role")
+
+	deleted, err := helper.DeleteRoleDefinition(role)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("DeleteRole: cannot delete role:%v", err)
+		return
+	}
+	if !deleted {
+		w.WriteHeader(http.StatusConflict)
+		_, err = w.Write([]byte("ERROR: role does not exist or is still assigned to users"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	message := "deleted role successfully"
+	err = utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("DeleteRole:%v", err)
+		return
+	}
+}
+
+func SetUserRoles(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("SetUserRoles:Context for ID:%v", ok)
+		return
+	}
+	userID, ok := targetUser(w, r, contextValues)
+	if !ok {
+		return
+	}
+
+	var userRoles models.UserRoles
+	decoderErr := utilities.Decoder(r, &userRoles)
+	if decoderErr != nil || len(userRoles.Roles) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("Decoder error:%v", decoderErr)
+		return
+	}
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		err := helper.SetUserRoles(userID, userRoles.Roles, tx)
+		if err != nil {
+			return err
+		}
+		return helper.RecordAdminAction(contextValues.ID, models.AuditUserRolesSet, userID, map[string]interface{}{"roles": userRoles.Roles}, tx)
+	})
+	if txErr != nil {
+		if utilities.IsForeignKeyViolation(txErr) || utilities.IsUniqueViolation(txErr) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, err := w.Write([]byte("ERROR: unknown user or role"))
+			if err != nil {
+				return
+			}
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("SetUserRoles:%v", txErr)
+		return
+	}
+
+	message := "updated user roles successfully"
+	err := utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("SetUserRoles:%v", err)
+		return
+	}
+}
+
+func GetOrders(w http.ResponseWriter, r *http.Request) {
+	filterCheck, err := filters(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("GetOrders:filterCheck:%v", err)
+		return
+	}
+
+	orders, err := helper.GetOrders(filterCheck)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("GetOrders: cannot get orders:%v", err)
+		return
+	}
+
+	err = utilities.Encoder(w, orders)
+	if err != nil {
+		logrus.Printf("GetOrders:%v", err)
+		return
+	}
+}
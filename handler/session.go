@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"Audiophile/database"
+	"Audiophile/database/helper"
+	"Audiophile/models"
+	"Audiophile/signing"
+	"Audiophile/utilities"
+	"database/sql"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+const (
+	accessTokenDuration  = 60 * time.Minute
+	refreshTokenDuration = helper.SessionDuration
+	refreshTokenSize     = 32
+)
+
+func createAccessToken(userID, sessionID uuid.UUID, role string, mfaVerified bool) (string, error) {
+	claims := &models.Claims{
+		ID:   userID,
+		Role: role,
+		MFA:  mfaVerified,
+		StandardClaims: jwt.StandardClaims{
+			Id:        sessionID.String(),
+			ExpiresAt: time.Now().Add(accessTokenDuration).Unix(),
+		},
+	}
+	return signing.Keys.Sign(claims)
+}
+
+// startSession creates a new session row for the device the request came from and returns
+// the access and refresh tokens for it
+func startSession(userID uuid.UUID, role, deviceName string, mfaVerified bool, r *http.Request) (map[string]interface{}, error) {
+	refreshToken, err := utilities.GenerateToken(refreshTokenSize)
+	if err != nil {
+		logrus.Printf("startSession: cannot generate refresh token:%v", err)
+		return nil, err
+	}
+
+	device := models.SessionDevice{
+		Role:        role,
+		DeviceName:  deviceName,
+		UserAgent:   r.UserAgent(),
+		IPAddress:   utilities.ClientIP(r),
+		MFAVerified: mfaVerified,
+	}
+
+	var sessionID uuid.UUID
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		sessionID, err = helper.CreateSession(userID, device, tx)
+		if err != nil {
+			return err
+		}
+		return helper.CreateRefreshToken(sessionID, utilities.HashToken(refreshToken), time.Now().Add(refreshTokenDuration), tx)
+	})
+	if txErr != nil {
+		logrus.Printf("startSession: cannot create session:%v", txErr)
+		return nil, txErr
+	}
+
+	tokenString, err := createAccessToken(userID, sessionID, role, mfaVerified)
+	if err != nil {
+		logrus.Printf("TokenString: cannot create token string:%v", err)
+		return nil, err
+	}
+
+	userOutboundData := make(map[string]interface{})
+	userOutboundData["token"] = tokenString
+	userOutboundData["refreshToken"] = refreshToken
+	return userOutboundData, nil
+}
+
+func RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var request models.RefreshTokenRequest
+	decoderErr := utilities.Decoder(r, &request)
+	if decoderErr != nil || request.RefreshToken == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("Decoder error:%v", decoderErr)
+		return
+	}
+
+	refreshToken, err := helper.FetchRefreshToken(utilities.HashToken(request.RefreshToken))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("RefreshToken: cannot get refresh token:%v", err)
+		return
+	}
+
+	if refreshToken.UsedAt != nil {
+		// a rotated token was presented again, so the whole family is treated as stolen
+		logrus.Printf("RefreshToken: reuse detected for session %v", refreshToken.SessionID)
+		if err = helper.RevokeSession(refreshToken.SessionID); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if refreshToken.SessionExpiresAt.Before(time.Now()) || refreshToken.ExpiresAt.Before(time.Now()) {
+		w.WriteHeader(http.StatusUnauthorized)
+		logrus.Printf("RefreshToken: session or refresh token expired")
+		return
+	}
+
+	newRefreshToken, err := utilities.GenerateToken(refreshTokenSize)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("RefreshToken: cannot generate refresh token:%v", err)
+		return
+	}
+
+	rotated := false
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		rotated, err = helper.UseRefreshToken(refreshToken.ID, tx)
+		if err != nil || !rotated {
+			return err
+		}
+		err = helper.CreateRefreshToken(refreshToken.SessionID, utilities.HashToken(newRefreshToken), time.Now().Add(refreshTokenDuration), tx)
+		if err != nil {
+			return err
+		}
+		return helper.TouchSession(refreshToken.SessionID, tx)
+	})
+	if txErr != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("RefreshToken:%v", txErr)
+		return
+	}
+	if !rotated {
+		// another request rotated the same token first, that is reuse just as much as the case above
+		logrus.Printf("RefreshToken: concurrent reuse detected for session %v", refreshToken.SessionID)
+		if err = helper.RevokeSession(refreshToken.SessionID); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	tokenString, err := createAccessToken(refreshToken.UserID, refreshToken.SessionID, refreshToken.Role, refreshToken.MFAVerified)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("TokenString: cannot create token string:%v", err)
+		return
+	}
+
+	userOutboundData := make(map[string]interface{})
+	userOutboundData["token"] = tokenString
+	userOutboundData["refreshToken"] = newRefreshToken
+
+	err = utilities.Encoder(w, userOutboundData)
+	if err != nil {
+		logrus.Printf("RefreshToken:%v", err)
+		return
+	}
+}
+
+func GetSessions(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("GetSessions:Context for ID:%v", ok)
+		return
+	}
+
+	sessions, err := helper.GetActiveSessions(contextValues.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("GetSessions: cannot get sessions:%v", err)
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == contextValues.SessionID
+	}
+
+	err = utilities.Encoder(w, sessions)
+	if err != nil {
+		logrus.Printf("GetSessions:%v", err)
+		return
+	}
+}
+
+func RevokeSession(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("RevokeSession:Context for ID:%v", ok)
+		return
+	}
+
+	sessionID, err := uuid.Parse(chi.URLParam(r, "sessionID"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("RevokeSession: invalid session id:%v", err)
+		return
+	}
+
+	revoked, err := helper.RevokeUserSession(contextValues.ID, sessionID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("RevokeSession: cannot revoke session:%v", err)
+		return
+	}
+	if !revoked {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	message := "revoked session successfully"
+	err = utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("RevokeSession:%v", err)
+		return
+	}
+}
+
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	err := utilities.Encoder(w, signing.Keys.JWKS())
+	if err != nil {
+		logrus.Printf("JWKS:%v", err)
+		return
+	}
+}
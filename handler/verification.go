@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"Audiophile/database/helper"
+	"Audiophile/mailer"
+	"Audiophile/models"
+	"Audiophile/signing"
+	"Audiophile/utilities"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const emailVerificationDuration = 24 * time.Hour
+
+// sendVerificationEmail mails a signed link that proves ownership of email for the given user
+func sendVerificationEmail(userID uuid.UUID, email string) error {
+	claims := &models.EmailVerificationClaims{
+		ID:      userID,
+		Email:   email,
+		Purpose: models.PurposeEmailVerification,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(emailVerificationDuration).Unix(),
+		},
+	}
+	token, err := signing.Keys.Sign(claims)
+	if err != nil {
+		logrus.Printf("sendVerificationEmail: cannot sign token:%v", err)
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", os.Getenv("frontend_url"), url.QueryEscape(token))
+	body := fmt.Sprintf("Welcome to Audiophile!\n\nPlease confirm your email address by opening the link below within %d hours:\n%s", int(emailVerificationDuration.Hours()), link)
+	return mailer.Default.Send(email, "Verify your Audiophile email", body)
+}
+
+func VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	claims := models.EmailVerificationClaims{}
+	tkn, err := jwt.ParseWithClaims(token, &claims, signing.Keys.Keyfunc)
+	if err != nil || !tkn.Valid || claims.Purpose != models.PurposeEmailVerification {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("VerifyEmail: invalid token:%v", err)
+		_, err = w.Write([]byte("ERROR: verification link is invalid or has expired"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	verified, err := helper.VerifyEmail(claims.ID, claims.Email)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("VerifyEmail: cannot verify email:%v", err)
+		return
+	}
+	if !verified {
+		w.WriteHeader(http.StatusBadRequest)
+		_, err = w.Write([]byte("ERROR: email no longer belongs to this account"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	message := "Email verified successfully"
+	err = utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("VerifyEmail:%v", err)
+		return
+	}
+}
+
+func ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ResendVerificationEmail:Context for ID:%v", ok)
+		return
+	}
+
+	status, err := helper.FetchEmailVerificationStatus(contextValues.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ResendVerificationEmail: cannot get verification status:%v", err)
+		return
+	}
+	if status.Verified {
+		w.WriteHeader(http.StatusConflict)
+		_, err = w.Write([]byte("ERROR: email is already verified"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	err = sendVerificationEmail(contextValues.ID, status.Email)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ResendVerificationEmail: cannot send mail:%v", err)
+		return
+	}
+
+	message := "Verification email sent"
+	err = utilities.Encoder(w, message)
+	if err != nil {
+		logrus.Printf("ResendVerificationEmail:%v", err)
+		return
+	}
+}
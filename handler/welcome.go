@@ -3,27 +3,22 @@ package handler
 import (
 	"Audiophile/database"
 	"Audiophile/database/helper"
+	"Audiophile/identity"
+	"Audiophile/lockout"
 	"Audiophile/models"
 	"Audiophile/utilities"
-	"context"
 	"database/sql"
-	firebase "firebase.google.com/go"
-	"github.com/dgrijalva/jwt-go"
+	"errors"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
-	"google.golang.org/api/option"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
-	"time"
 )
 
-var JwtKey = []byte("secret_key")
-
 func Login(w http.ResponseWriter, r *http.Request) {
 	var userDetails models.UsersLoginDetails
 	decoderErr := utilities.Decoder(r, &userDetails)
@@ -35,16 +30,25 @@ func Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if userDetails.Email == "" {
-		OauthLogin(userDetails.OauthToken, w, r)
+		OauthLogin(userDetails.Provider, userDetails.OauthToken, userDetails.DeviceName, w, r)
 		return
 	}
 
 	userDetails.Email = strings.ToLower(userDetails.Email)
 
-	userCredentials, fetchErr := helper.FetchPasswordAndIDANDRole(userDetails.Email, userDetails.Role)
+	emailKey := lockout.Key{Kind: lockout.KindEmail, Value: userDetails.Email}
+	ipKey := lockout.Key{Kind: lockout.KindIP, Value: utilities.ClientIP(r)}
+	if checkLockout(w, emailKey, ipKey) {
+		return
+	}
+
+	userCredentials, fetchErr := helper.FetchLoginCredentials(userDetails.Email)
 
 	if fetchErr != nil {
 		if fetchErr == sql.ErrNoRows {
+			if recordLoginFailure(w, emailKey, ipKey) {
+				return
+			}
 			w.WriteHeader(http.StatusBadRequest)
 			_, err := w.Write([]byte("ERROR: Wrong details"))
 			if err != nil {
@@ -59,6 +63,9 @@ func Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if PasswordErr := bcrypt.CompareHashAndPassword([]byte(userCredentials.Password), []byte(userDetails.Password)); PasswordErr != nil {
+		if recordLoginFailure(w, emailKey, ipKey) {
+			return
+		}
 		w.WriteHeader(http.StatusUnauthorized)
 		logrus.Printf("password misMatch")
 		_, err := w.Write([]byte("ERROR: Wrong password"))
@@ -68,121 +75,112 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	expiresAt := time.Now().Add(60 * time.Minute)
-
-	claims := &models.Claims{
-		ID:   userCredentials.ID,
-		Role: userCredentials.Role,
-		StandardClaims: jwt.StandardClaims{
-
-			ExpiresAt: expiresAt.Unix(),
-			// Issuer:    userCredentials.Role,
-		},
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(JwtKey)
+	err := lockout.Default.Succeed(emailKey)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		logrus.Printf("TokenString: cannot create token string:%v", err)
-		return
+		logrus.Printf("Login: cannot clear failed attempts:%v", err)
 	}
 
-	err = helper.CreateSession(claims)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		logrus.Printf("CreateSession: cannot create session:%v", err)
-		return
-	}
-
-	userOutboundData := make(map[string]interface{})
-
-	userOutboundData["token"] = tokenString
-
-	err = utilities.Encoder(w, userOutboundData)
-	if err != nil {
-		logrus.Printf("Login: Not able to login:%v", err)
-		return
-	}
+	completeLogin(w, r, userCredentials.ID, userCredentials.Role, userDetails.DeviceName)
 }
 
-func OauthLogin(oauthToken string, w http.ResponseWriter, r *http.Request) {
-	opt := option.WithCredentialsJSON([]byte(os.Getenv("firebase_key")))
-	app, err := firebase.NewApp(context.Background(), nil, opt)
-	if err != nil {
-		logrus.Printf("OAuth:cannot create firebase application object:%v", err)
-		return
+// OauthLogin logs in with a token of an external identity provider, identities seen for the first time
+// create a new account unless their email already belongs to one, which then has to link them itself
+func OauthLogin(providerName, oauthToken, deviceName string, w http.ResponseWriter, r *http.Request) {
+	if providerName == "" {
+		providerName = identity.ProviderFirebase
 	}
-	client, err := app.Auth(context.Background())
+	provider, err := identity.Get(providerName)
 	if err != nil {
-		logrus.Printf("OauthLogin:cannot create client client:%v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("OauthLogin:%v", err)
+		return
 	}
 
-	//header := r.Header.Get(echo.HeaderAuthorization)
-	idToken := strings.TrimSpace(strings.Replace(oauthToken, "Bearer", "", 1))
-	firebaseToken, err := client.VerifyIDToken(context.Background(), idToken)
+	externalIdentity, err := provider.Verify(r.Context(), oauthToken)
 	if err != nil {
+		if err == identity.ErrInvalidToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			logrus.Printf("OauthLogin:cannot verify token:%v", err)
+			return
+		}
 		w.WriteHeader(http.StatusInternalServerError)
 		logrus.Printf("OauthLogin:cannot verify token:%v", err)
 		return
 	}
-	userDetails, err := client.GetUser(context.Background(), firebaseToken.UID)
-	if err != nil {
-		logrus.Printf("OauthLogin: cannot get user details:%v", err)
-		return
-	}
 
-	err = helper.CheckEmail(userDetails.Email)
-	var userID uuid.UUID
+	userID, err := helper.FetchIdentityUser(externalIdentity.Provider, externalIdentity.Subject)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			ID, createErr := helper.CreateNewUser(userDetails)
-			if createErr != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				logrus.Printf("OauthLogin: cannot create new user:%v", createErr)
+		if err != sql.ErrNoRows {
+			w.WriteHeader(http.StatusInternalServerError)
+			logrus.Printf("OauthLogin: cannot get identity:%v", err)
+			return
+		}
+
+		if externalIdentity.Email == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, err = w.Write([]byte("ERROR: identity provider did not share an email"))
+			if err != nil {
 				return
 			}
-			userID = ID
-		} else {
-			logrus.Printf("OauthLogin: cannot check user google email:%v", err)
 			return
 		}
-	}
-
-	expiresAt := time.Now().Add(60 * time.Minute)
 
-	claims := &models.Claims{
-		ID:   userID,
-		Role: "user",
-		StandardClaims: jwt.StandardClaims{
+		if externalIdentity.EmailVerified {
+			// accounts made by the firebase login before identities were stored are adopted here
+			legacyUserID, err := helper.FetchPasswordlessUserID(externalIdentity.Email)
+			if err == nil {
+				txErr := database.Tx(func(tx *sqlx.Tx) error {
+					return helper.LinkIdentity(legacyUserID, externalIdentity, tx)
+				})
+				if txErr != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					logrus.Printf("OauthLogin: cannot link identity:%v", txErr)
+					return
+				}
+				completeLogin(w, r, legacyUserID, string(models.UserRoleUser), deviceName)
+				return
+			}
+			if err != sql.ErrNoRows {
+				w.WriteHeader(http.StatusInternalServerError)
+				logrus.Printf("OauthLogin: cannot check email:%v", err)
+				return
+			}
+		}
 
-			ExpiresAt: expiresAt.Unix(),
-			// Issuer:    userCredentials.Role,
-		},
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(JwtKey)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		logrus.Printf("TokenString: cannot create token string:%v", err)
-		return
-	}
+		_, err = helper.FetchUserIDByEmail(externalIdentity.Email)
+		if err == nil {
+			w.WriteHeader(http.StatusConflict)
+			_, err = w.Write([]byte("ERROR: an account with this email already exists, log in and link this identity from your account"))
+			if err != nil {
+				return
+			}
+			return
+		}
+		if err != sql.ErrNoRows {
+			w.WriteHeader(http.StatusInternalServerError)
+			logrus.Printf("OauthLogin: cannot check email:%v", err)
+			return
+		}
 
-	err = helper.CreateSession(claims)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		logrus.Printf("CreateSession: cannot create session:%v", err)
-		return
+		txErr := database.Tx(func(tx *sqlx.Tx) error {
+			userID, err = helper.CreateNewUser(externalIdentity, tx)
+			if err != nil {
+				return err
+			}
+			err = helper.CreateRole(userID, models.UserRoleUser, tx)
+			if err != nil {
+				return err
+			}
+			return helper.LinkIdentity(userID, externalIdentity, tx)
+		})
+		if txErr != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			logrus.Printf("OauthLogin: cannot create new user:%v", txErr)
+			return
+		}
 	}
 
-	userOutboundData := make(map[string]interface{})
-
-	userOutboundData["token"] = tokenString
-
-	err = utilities.Encoder(w, userOutboundData)
-	if err != nil {
-		logrus.Printf("Login: Not able to login:%v", err)
-		return
-	}
+	completeLogin(w, r, userID, string(models.UserRoleUser), deviceName)
 }
 
 func Logout(w http.ResponseWriter, r *http.Request) {
@@ -194,7 +192,7 @@ func Logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := helper.Logout(contextValues.ID)
+	err := helper.Logout(contextValues.SessionID)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		logrus.Printf("Logout:unable to logout:%v", err)
@@ -234,17 +232,25 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err := sendVerificationEmail(userDetails.ID, userDetails.Email)
+	if err != nil {
+		logrus.Printf("Register: cannot send verification email:%v", err)
+	}
+
 	userOutboundData := make(map[string]uuid.UUID)
 
 	userOutboundData["Successfully Registered: ID is"] = userDetails.ID
 
-	err := utilities.Encoder(w, userOutboundData)
+	err = utilities.Encoder(w, userOutboundData)
 	if err != nil {
 		logrus.Printf("Register:%v", err)
 		return
 	}
 }
 
+// maxPageLimit caps the page size of every listing, larger limits are lowered to it
+const maxPageLimit = 100
+
 func filters(r *http.Request) (models.FiltersCheck, error) {
 	filtersCheck := models.FiltersCheck{}
 	isSearched := false
@@ -265,6 +271,12 @@ func filters(r *http.Request) (models.FiltersCheck, error) {
 			logrus.Printf("Limit: cannot get limit:%v", err)
 			return filtersCheck, err
 		}
+		if limit < 1 {
+			return filtersCheck, errors.New("limit must be at least 1")
+		}
+		if limit > maxPageLimit {
+			limit = maxPageLimit
+		}
 	}
 
 	strPage := r.URL.Query().Get("page")
@@ -276,6 +288,9 @@ func filters(r *http.Request) (models.FiltersCheck, error) {
 			logrus.Printf("Page: cannot get page:%v", err)
 			return filtersCheck, err
 		}
+		if page < 0 {
+			return filtersCheck, errors.New("page must not be negative")
+		}
 	}
 
 	filtersCheck = models.FiltersCheck{
@@ -286,14 +301,44 @@ func filters(r *http.Request) (models.FiltersCheck, error) {
 	return filtersCheck, nil
 }
 
+// cursorFilters reads the keyset cursor and whether the exact total is wanted, for the listings that
+// page by cursor
+func cursorFilters(r *http.Request, filterCheck *models.FiltersCheck, sort string) error {
+	if encoded := r.URL.Query().Get("cursor"); encoded != "" {
+		cursor, err := models.DecodeCursor(encoded)
+		if err != nil || cursor.Sort != sort {
+			return helper.ErrInvalidCursor
+		}
+		filterCheck.Cursor = &cursor
+	}
+
+	if total := r.URL.Query().Get("total"); total != "" {
+		withTotal, err := strconv.ParseBool(total)
+		if err != nil {
+			return err
+		}
+		filterCheck.WithTotal = withTotal
+	}
+	return nil
+}
+
 func GetUsers(w http.ResponseWriter, r *http.Request) {
 	filterCheck, err := filters(r)
+	if err == nil {
+		err = cursorFilters(r, &filterCheck, models.SortName)
+	}
 	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
 		logrus.Printf("GetUsers:filterCheck:%v", err)
+		return
 	}
 
 	adminGetUserDetails, AdminGetUserErr := helper.GetUsers(filterCheck)
 	if AdminGetUserErr != nil {
+		if AdminGetUserErr == helper.ErrInvalidCursor {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
 		w.WriteHeader(http.StatusInternalServerError)
 		logrus.Printf("GetUser: not able to get users :%v ", AdminGetUserErr)
 		return
@@ -311,7 +356,7 @@ func AddCategory(w http.ResponseWriter, r *http.Request) {
 
 	decoderErr := utilities.Decoder(r, &categoryDetails)
 
-	if decoderErr != nil {
+	if decoderErr != nil || strings.TrimSpace(categoryDetails.Name) == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		logrus.Printf("Decoder error:%v", decoderErr)
 		return
@@ -319,6 +364,14 @@ func AddCategory(w http.ResponseWriter, r *http.Request) {
 
 	categoryID, err := helper.AddCategory(&categoryDetails)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusBadRequest)
+			_, err = w.Write([]byte("ERROR: parent category does not exist"))
+			if err != nil {
+				return
+			}
+			return
+		}
 		w.WriteHeader(http.StatusInternalServerError)
 		logrus.Printf("AddCategory:cannot add category:%v", err)
 		return
@@ -340,20 +393,34 @@ func AddBrands(w http.ResponseWriter, r *http.Request) {
 
 	decoderErr := utilities.Decoder(r, &brandDetails)
 
-	if decoderErr != nil {
+	if decoderErr != nil || strings.TrimSpace(brandDetails.BrandName) == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		logrus.Printf("Decoder error:%v", decoderErr)
 		return
 	}
 
-	err := helper.AddBrands(&brandDetails)
+	if brandDetails.Slug == "" {
+		brandDetails.Slug = utilities.Slugify(brandDetails.BrandName)
+	}
+	if !utilities.IsSlug(brandDetails.Slug) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, err := w.Write([]byte("ERROR: slug may only contain lower case letters, digits and single dashes"))
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	brandID, err := helper.AddBrands(&brandDetails)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		logrus.Printf("AddBrands: cannot add brand:%v", err)
+		if !brandWriteError(w, err) {
+			w.WriteHeader(http.StatusInternalServerError)
+			logrus.Printf("AddBrands: cannot add brand:%v", err)
+		}
 		return
 	}
 
-	message := "Successfully added brand"
+	message := map[string]interface{}{"Successfully added brand: ID is": brandID, "slug": brandDetails.Slug}
 	err = utilities.Encoder(w, message)
 	if err != nil {
 		logrus.Printf("AddProduct:%v", err)
@@ -378,12 +445,52 @@ func AddProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	categoryID := r.URL.Query().Get("categoryID")
+	categoryID, err := uuid.Parse(r.URL.Query().Get("categoryID"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("AddProduct: invalid category id:%v", err)
+		return
+	}
 
-	err := helper.AddProduct(productDetails, categoryID)
+	definitions, err := helper.GetCategoryAttributes(categoryID)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		logrus.Printf("AddProduct:cannot add product to inventory:%v", err)
+		logrus.Printf("AddProduct:%v", err)
+		return
+	}
+
+	attributes := make([]map[uuid.UUID]models.AttributeValue, len(productDetails))
+	for i, product := range productDetails {
+		err = requiredAttributes(definitions, product.Attributes)
+		if err == nil {
+			attributes[i], _, err = parseProductAttributes(definitions, product.Attributes)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, err = w.Write([]byte("ERROR: " + product.Name + ": " + err.Error()))
+			if err != nil {
+				return
+			}
+			return
+		}
+	}
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		for i, product := range productDetails {
+			productID, err := helper.AddProduct(product, categoryID.String(), tx)
+			if err != nil {
+				return err
+			}
+			err = helper.SetProductAttributes(productID, attributes[i], tx)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if txErr != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("AddProduct:cannot add product to inventory:%v", txErr)
 		return
 	}
 
@@ -428,19 +535,36 @@ func AddProductImages(w http.ResponseWriter, r *http.Request) {
 }
 
 func ViewProducts(w http.ResponseWriter, r *http.Request) {
-	filterCheck, err := filters(r)
+	filterCheck, err := productFilters(r)
 	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
 		logrus.Printf("ViewProduct: filterCheck error:%v", err)
+		_, err = w.Write([]byte("ERROR: " + err.Error()))
+		if err != nil {
+			return
+		}
 		return
 	}
 
 	productDetails, productDetailsErr := helper.ViewProducts(filterCheck)
 	if productDetailsErr != nil {
+		if productDetailsErr == helper.ErrInvalidCursor {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
 		w.WriteHeader(http.StatusInternalServerError)
 		logrus.Printf("ViewProducts: not able to get productDetails: %v", productDetailsErr)
 		return
 	}
 
+	facets, err := helper.GetProductFacets(filterCheck)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("ViewProducts: not able to get facets: %v", err)
+		return
+	}
+	productDetails.Facets = &facets
+
 	err = utilities.Encoder(w, productDetails)
 	if err != nil {
 		logrus.Printf("ViewProduct: %v", err)
@@ -448,8 +572,46 @@ func ViewProducts(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func GetProduct(w http.ResponseWriter, r *http.Request) {
+	productID, err := uuid.Parse(chi.URLParam(r, "productID"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("GetProduct: invalid product id:%v", err)
+		return
+	}
+
+	product, err := helper.FetchProduct(productID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("GetProduct: cannot get product:%v", err)
+		return
+	}
+
+	product.Attributes, err = helper.GetProductAttributes(productID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("GetProduct: cannot get product attributes:%v", err)
+		return
+	}
+
+	err = utilities.Encoder(w, product)
+	if err != nil {
+		logrus.Printf("GetProduct:%v", err)
+		return
+	}
+}
+
 func UpdateProduct(w http.ResponseWriter, r *http.Request) {
-	productID := chi.URLParam(r, "productID")
+	productID, err := uuid.Parse(chi.URLParam(r, "productID"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logrus.Printf("UpdateProduct: invalid product id:%v", err)
+		return
+	}
 
 	var productDetails models.ProductUpdateDetails
 	decoderErr := utilities.Decoder(r, &productDetails)
@@ -459,7 +621,49 @@ func UpdateProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	updateProductErr := helper.UpdateProduct(productID, productDetails)
+	var attributes map[uuid.UUID]models.AttributeValue
+	var removed []string
+	if len(productDetails.Attributes) > 0 {
+		categoryID, err := helper.FetchProductCategory(productID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			logrus.Printf("UpdateProduct:%v", err)
+			return
+		}
+
+		definitions, err := helper.GetCategoryAttributes(categoryID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			logrus.Printf("UpdateProduct:%v", err)
+			return
+		}
+
+		attributes, removed, err = parseProductAttributes(definitions, productDetails.Attributes)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, err = w.Write([]byte("ERROR: " + err.Error()))
+			if err != nil {
+				return
+			}
+			return
+		}
+	}
+
+	updateProductErr := database.Tx(func(tx *sqlx.Tx) error {
+		err := helper.UpdateProduct(productID.String(), productDetails, tx)
+		if err != nil {
+			return err
+		}
+		err = helper.SetProductAttributes(productID, attributes, tx)
+		if err != nil || len(removed) == 0 {
+			return err
+		}
+		return helper.RemoveProductAttributes(productID, removed, tx)
+	})
 	if updateProductErr != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		logrus.Printf("UpdateProduct: not able to update product:%v", updateProductErr)
@@ -467,7 +671,7 @@ func UpdateProduct(w http.ResponseWriter, r *http.Request) {
 	}
 
 	message := "updated product successfully"
-	err := utilities.Encoder(w, message)
+	err = utilities.Encoder(w, message)
 	if err != nil {
 		logrus.Printf("UpdateProduct:%v", err)
 		return
@@ -713,6 +917,23 @@ func InstantPayment(w http.ResponseWriter, r *http.Request) {
 		logrus.Printf("Decoder Error:%v", err)
 		return
 	}
+
+	if paymentDetails.PaymentType == models.PaymentTypeCOD && phoneRequiredForCOD() {
+		phoneStatus, err := helper.FetchPhoneStatus(contextValues.ID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			logrus.Printf("InstantPayment: cannot get phone status:%v", err)
+			return
+		}
+		if !phoneStatus.Verified {
+			w.WriteHeader(http.StatusForbidden)
+			_, err = w.Write([]byte("ERROR: please verify your phone number to pay cash on delivery"))
+			if err != nil {
+				return
+			}
+			return
+		}
+	}
 	// transaction begin
 	txErr := database.Tx(func(tx *sqlx.Tx) error {
 		paymentID, err := helper.InstantPayment(contextValues.ID, paymentDetails, orderID, tx)
@@ -0,0 +1,56 @@
+package identity
+
+import (
+	"Audiophile/models"
+	"context"
+	"strings"
+	"sync"
+)
+
+const (
+	ProviderFake    = "fake"
+	fakeTokenPrefix = "fake:"
+)
+
+// FakeProvider trusts whatever it is told and is meant for tests and local development, identities can be
+// registered per token with Add, and any token of the form "fake:<email>" is accepted as a verified email
+type FakeProvider struct {
+	mu         sync.RWMutex
+	identities map[string]models.ExternalIdentity
+}
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{identities: make(map[string]models.ExternalIdentity)}
+}
+
+func (p *FakeProvider) Name() string {
+	return ProviderFake
+}
+
+func (p *FakeProvider) Add(token string, externalIdentity models.ExternalIdentity) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	externalIdentity.Provider = ProviderFake
+	p.identities[token] = externalIdentity
+}
+
+func (p *FakeProvider) Verify(ctx context.Context, token string) (models.ExternalIdentity, error) {
+	p.mu.RLock()
+	externalIdentity, ok := p.identities[token]
+	p.mu.RUnlock()
+	if ok {
+		return externalIdentity, nil
+	}
+
+	if !strings.HasPrefix(token, fakeTokenPrefix) || len(token) == len(fakeTokenPrefix) {
+		return models.ExternalIdentity{}, ErrInvalidToken
+	}
+	email := strings.ToLower(strings.TrimPrefix(token, fakeTokenPrefix))
+	return models.ExternalIdentity{
+		Provider:      ProviderFake,
+		Subject:       "fake-" + email,
+		Email:         email,
+		EmailVerified: true,
+		Name:          strings.Split(email, "@")[0],
+	}, nil
+}
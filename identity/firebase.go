@@ -0,0 +1,71 @@
+package identity
+
+import (
+	"Audiophile/models"
+	"context"
+	firebase "firebase.google.com/go"
+	"firebase.google.com/go/auth"
+	"google.golang.org/api/option"
+	"strings"
+	"sync"
+)
+
+// FirebaseProvider verifies Firebase ID tokens, the auth client is created once and then reused
+type FirebaseProvider struct {
+	credentials string
+	once        sync.Once
+	client      *auth.Client
+	err         error
+}
+
+func NewFirebaseProvider(credentials string) *FirebaseProvider {
+	return &FirebaseProvider{credentials: credentials}
+}
+
+func (p *FirebaseProvider) Name() string {
+	return ProviderFirebase
+}
+
+// Client lazily creates the auth client, it outlives the request so it is not tied to its context
+func (p *FirebaseProvider) Client() (*auth.Client, error) {
+	p.once.Do(func() {
+		ctx := context.Background()
+		opt := option.WithCredentialsJSON([]byte(p.credentials))
+		app, err := firebase.NewApp(ctx, nil, opt)
+		if err != nil {
+			p.err = err
+			return
+		}
+		p.client, p.err = app.Auth(ctx)
+	})
+	return p.client, p.err
+}
+
+func (p *FirebaseProvider) Verify(ctx context.Context, token string) (models.ExternalIdentity, error) {
+	var externalIdentity models.ExternalIdentity
+
+	client, err := p.Client()
+	if err != nil {
+		return externalIdentity, err
+	}
+
+	idToken := strings.TrimSpace(strings.Replace(token, "Bearer", "", 1))
+	firebaseToken, err := client.VerifyIDToken(ctx, idToken)
+	if err != nil {
+		return externalIdentity, ErrInvalidToken
+	}
+
+	userRecord, err := client.GetUser(ctx, firebaseToken.UID)
+	if err != nil {
+		return externalIdentity, err
+	}
+
+	return models.ExternalIdentity{
+		Provider:      ProviderFirebase,
+		Subject:       userRecord.UID,
+		Email:         strings.ToLower(userRecord.Email),
+		EmailVerified: userRecord.EmailVerified,
+		Name:          userRecord.DisplayName,
+		PhoneNumber:   userRecord.PhoneNumber,
+	}, nil
+}
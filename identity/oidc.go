@@ -0,0 +1,244 @@
+package identity
+
+import (
+	"Audiophile/models"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/sirupsen/logrus"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	discoveryPath = "/.well-known/openid-configuration"
+	// keysTTL is how long a fetched JWKS is trusted before it is fetched again
+	keysTTL = time.Hour
+	// minRefreshInterval stops tokens with unknown kids from making us hammer the issuer
+	minRefreshInterval = time.Minute
+)
+
+type OIDCConfig struct {
+	Name     string `json:"name"`
+	Issuer   string `json:"issuer"`
+	ClientID string `json:"clientId"`
+}
+
+type discoveryDocument struct {
+	Issuer  string `json:"issuer"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+// OIDCProvider verifies ID tokens of any OpenID Connect issuer, the discovery document and the
+// issuer's signing keys are cached and refreshed when a token refers to a key we have not seen
+type OIDCProvider struct {
+	config     OIDCConfig
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	jwksURI   string
+	keys      map[string]interface{}
+	fetchedAt time.Time
+}
+
+func NewOIDCProvider(config OIDCConfig) *OIDCProvider {
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+	return &OIDCProvider{
+		config:     config,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *OIDCProvider) Name() string {
+	return p.config.Name
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, url string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			logrus.Printf("OIDCProvider: unable to close body:%v", closeErr)
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("identity: %s answered %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
+
+// refreshKeys must be called with p.mu held
+func (p *OIDCProvider) refreshKeys(ctx context.Context) error {
+	if p.jwksURI == "" {
+		var discovery discoveryDocument
+		if err := p.getJSON(ctx, p.config.Issuer+discoveryPath, &discovery); err != nil {
+			return err
+		}
+		if strings.TrimSuffix(discovery.Issuer, "/") != p.config.Issuer {
+			return fmt.Errorf("identity: discovery issuer %q does not match %q", discovery.Issuer, p.config.Issuer)
+		}
+		p.jwksURI = discovery.JWKSURI
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.jwksURI, &jwks); err != nil {
+		return err
+	}
+
+	keys := make(map[string]interface{}, len(jwks.Keys))
+	for _, key := range jwks.Keys {
+		publicKey, err := key.publicKey()
+		if err != nil {
+			logrus.Printf("OIDCProvider: skipping key %s:%v", key.KeyID, err)
+			continue
+		}
+		keys[key.KeyID] = publicKey
+	}
+	p.keys = keys
+	p.fetchedAt = time.Now()
+	return nil
+}
+
+func (p *OIDCProvider) key(ctx context.Context, keyID string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key, ok := p.keys[keyID]
+	stale := time.Since(p.fetchedAt) > keysTTL
+	if ok && !stale {
+		return key, nil
+	}
+	if !stale && time.Since(p.fetchedAt) < minRefreshInterval {
+		return nil, ErrInvalidToken
+	}
+	if err := p.refreshKeys(ctx); err != nil {
+		if ok {
+			logrus.Printf("OIDCProvider: using cached key after failed refresh:%v", err)
+			return key, nil
+		}
+		return nil, err
+	}
+	key, ok = p.keys[keyID]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	return key, nil
+}
+
+func (p *OIDCProvider) Verify(ctx context.Context, token string) (models.ExternalIdentity, error) {
+	var externalIdentity models.ExternalIdentity
+
+	claims := jwt.MapClaims{}
+	var keyErr error
+	tkn, err := jwt.ParseWithClaims(strings.TrimSpace(strings.Replace(token, "Bearer", "", 1)), claims, func(t *jwt.Token) (interface{}, error) {
+		switch t.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		default:
+			return nil, ErrInvalidToken
+		}
+		keyID, _ := t.Header["kid"].(string)
+		key, err := p.key(ctx, keyID)
+		keyErr = err
+		return key, err
+	})
+	if keyErr != nil && keyErr != ErrInvalidToken {
+		return externalIdentity, keyErr
+	}
+	if err != nil || !tkn.Valid {
+		return externalIdentity, ErrInvalidToken
+	}
+
+	issuer, _ := claims["iss"].(string)
+	if strings.TrimSuffix(issuer, "/") != p.config.Issuer || !hasAudience(claims["aud"], p.config.ClientID) {
+		return externalIdentity, ErrInvalidToken
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return externalIdentity, ErrInvalidToken
+	}
+	email, _ := claims["email"].(string)
+	emailVerified, _ := claims["email_verified"].(bool)
+	name, _ := claims["name"].(string)
+	phoneNumber, _ := claims["phone_number"].(string)
+
+	return models.ExternalIdentity{
+		Provider:      p.config.Name,
+		Subject:       subject,
+		Email:         strings.ToLower(email),
+		EmailVerified: emailVerified,
+		Name:          name,
+		PhoneNumber:   phoneNumber,
+	}, nil
+}
+
+// hasAudience accepts both forms of the aud claim, a single string or a list of strings
+func hasAudience(aud interface{}, clientID string) bool {
+	switch audience := aud.(type) {
+	case string:
+		return audience == clientID
+	case []interface{}:
+		for _, entry := range audience {
+			if entry == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Curve != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, errors.New("unsupported key type " + k.KeyType)
+}
@@ -0,0 +1,69 @@
+// Package identity verifies tokens issued by external identity providers such as Firebase or any
+// OpenID Connect issuer and turns them into models.ExternalIdentity
+package identity
+
+import (
+	"Audiophile/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"os"
+	"sync"
+)
+
+const ProviderFirebase = "firebase"
+
+var (
+	ErrUnknownProvider = errors.New("unknown identity provider")
+	ErrInvalidToken    = errors.New("identity token is invalid")
+
+	mu        sync.RWMutex
+	providers = make(map[string]IdentityProvider)
+)
+
+type IdentityProvider interface {
+	Name() string
+	Verify(ctx context.Context, token string) (models.ExternalIdentity, error)
+}
+
+func Register(provider IdentityProvider) {
+	mu.Lock()
+	defer mu.Unlock()
+	providers[provider.Name()] = provider
+}
+
+func Get(name string) (IdentityProvider, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	provider, ok := providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return provider, nil
+}
+
+// Init registers Firebase when firebase_key is set, every issuer listed in the oidc_providers json
+// and, for local development only, the fake provider when identity_fake_provider is true
+func Init() error {
+	if key := os.Getenv("firebase_key"); key != "" {
+		Register(NewFirebaseProvider(key))
+	}
+
+	if config := os.Getenv("oidc_providers"); config != "" {
+		oidcConfigs := make([]OIDCConfig, 0)
+		if err := json.Unmarshal([]byte(config), &oidcConfigs); err != nil {
+			return fmt.Errorf("identity: cannot parse oidc_providers: %v", err)
+		}
+		for _, oidcConfig := range oidcConfigs {
+			Register(NewOIDCProvider(oidcConfig))
+		}
+	}
+
+	if os.Getenv("identity_fake_provider") == "true" {
+		logrus.Printf("identity: fake identity provider is enabled, never use this in production")
+		Register(NewFakeProvider())
+	}
+	return nil
+}
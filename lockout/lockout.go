@@ -0,0 +1,128 @@
+// Package lockout throttles logins by counting failed attempts per email, per user and per IP address
+// and locking a key out for an exponentially growing period once it crosses its policy threshold, password
+// reset requests are counted the same way so that they cannot be used to flood an inbox
+package lockout
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	KindEmail = "email"
+	KindIP    = "ip"
+	// KindUser counts the failed second factors and password confirmations of an account, whatever
+	// address or session they come from
+	KindUser = "user"
+	// KindResetEmail and KindResetIP count password reset requests, every request counts as a failure
+	KindResetEmail = "reset_email"
+	KindResetIP    = "reset_ip"
+)
+
+type Policy struct {
+	// Threshold is how many failures are allowed before the first lockout
+	Threshold int
+	// BaseLockout is the first lockout period, it doubles with every further failure up to MaxLockout
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+	// Window is how long a failure is remembered
+	Window time.Duration
+}
+
+// LockDuration returns how long a key is locked after its given number of failures
+func (p Policy) LockDuration(failures int) time.Duration {
+	if failures < p.Threshold {
+		return 0
+	}
+	lock := p.BaseLockout
+	for i := p.Threshold; i < failures; i++ {
+		lock *= 2
+		if lock >= p.MaxLockout {
+			return p.MaxLockout
+		}
+	}
+	return lock
+}
+
+type Limiter struct {
+	Store    Store
+	Policies map[string]Policy
+}
+
+var Default = &Limiter{
+	Store: PostgresStore{},
+	Policies: map[string]Policy{
+		KindEmail: {Threshold: 5, BaseLockout: 30 * time.Second, MaxLockout: time.Hour, Window: 24 * time.Hour},
+		// an address is often shared by many users behind a NAT, so it is allowed more failures
+		KindIP: {Threshold: 20, BaseLockout: 30 * time.Second, MaxLockout: time.Hour, Window: 24 * time.Hour},
+		// a second factor has only a million codes, so its lockouts keep growing up to a day
+		KindUser: {Threshold: 5, BaseLockout: time.Minute, MaxLockout: 24 * time.Hour, Window: 24 * time.Hour},
+		// a handful of reset mails per address is plenty, past that every further one waits longer
+		KindResetEmail: {Threshold: 3, BaseLockout: 15 * time.Minute, MaxLockout: 24 * time.Hour, Window: 24 * time.Hour},
+		KindResetIP:    {Threshold: 20, BaseLockout: time.Minute, MaxLockout: time.Hour, Window: 24 * time.Hour},
+	},
+}
+
+// Key identifies one throttled subject such as an email, a user id or an IP address
+type Key struct {
+	Kind  string
+	Value string
+}
+
+// RetryAfter returns how long the longest lockout among keys still lasts, zero means none is locked
+func (l *Limiter) RetryAfter(keys ...Key) (time.Duration, error) {
+	var retryAfter time.Duration
+	now := time.Now()
+	for _, key := range keys {
+		attempt, err := l.Store.Get(key.Kind, key.Value)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				continue
+			}
+			return 0, err
+		}
+		if attempt.LockedUntil != nil && attempt.LockedUntil.After(now) {
+			if wait := attempt.LockedUntil.Sub(now); wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+	return retryAfter, nil
+}
+
+// Fail records a failed attempt for every key, locks those that crossed their threshold and returns
+// the longest resulting lockout
+func (l *Limiter) Fail(keys ...Key) (time.Duration, error) {
+	var retryAfter time.Duration
+	for _, key := range keys {
+		policy, ok := l.Policies[key.Kind]
+		if !ok {
+			continue
+		}
+		failures, err := l.Store.RecordFailure(key.Kind, key.Value, policy.Window)
+		if err != nil {
+			return 0, err
+		}
+		lock := policy.LockDuration(failures)
+		if lock == 0 {
+			continue
+		}
+		if err = l.Store.Lock(key.Kind, key.Value, time.Now().Add(lock)); err != nil {
+			return 0, err
+		}
+		if lock > retryAfter {
+			retryAfter = lock
+		}
+	}
+	return retryAfter, nil
+}
+
+// Succeed forgets the failures of the given keys
+func (l *Limiter) Succeed(keys ...Key) error {
+	for _, key := range keys {
+		if err := l.Store.Clear(key.Kind, key.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
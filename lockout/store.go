@@ -0,0 +1,112 @@
+package lockout
+
+import (
+	"Audiophile/database/helper"
+	"Audiophile/models"
+	"database/sql"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store keeps failed login attempts, Get returns sql.ErrNoRows for keys without failures
+type Store interface {
+	Get(kind, value string) (models.LoginAttempt, error)
+	RecordFailure(kind, value string, window time.Duration) (int, error)
+	Lock(kind, value string, until time.Time) error
+	Clear(kind, value string) error
+	List() ([]models.LoginAttempt, error)
+}
+
+// PostgresStore keeps attempts in the login_attempts table so every instance shares them
+type PostgresStore struct{}
+
+func (PostgresStore) Get(kind, value string) (models.LoginAttempt, error) {
+	return helper.FetchLoginAttempt(kind, value)
+}
+
+func (PostgresStore) RecordFailure(kind, value string, window time.Duration) (int, error) {
+	return helper.RecordLoginFailure(kind, value, window)
+}
+
+func (PostgresStore) Lock(kind, value string, until time.Time) error {
+	return helper.LockLogin(kind, value, until)
+}
+
+func (PostgresStore) Clear(kind, value string) error {
+	return helper.ClearLoginAttempts(kind, value)
+}
+
+func (PostgresStore) List() ([]models.LoginAttempt, error) {
+	return helper.GetLoginAttempts()
+}
+
+// MemoryStore keeps attempts in process, it is meant for tests and single instance setups
+type MemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string]*models.LoginAttempt
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{attempts: make(map[string]*models.LoginAttempt)}
+}
+
+func memoryKey(kind, value string) string {
+	return kind + ":" + value
+}
+
+func (m *MemoryStore) Get(kind, value string) (models.LoginAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	attempt, ok := m.attempts[memoryKey(kind, value)]
+	if !ok {
+		return models.LoginAttempt{}, sql.ErrNoRows
+	}
+	return *attempt, nil
+}
+
+func (m *MemoryStore) RecordFailure(kind, value string, window time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	attempt, ok := m.attempts[memoryKey(kind, value)]
+	if !ok {
+		attempt = &models.LoginAttempt{Kind: kind, Value: value}
+		m.attempts[memoryKey(kind, value)] = attempt
+	}
+	if attempt.LastFailedAt.Before(now.Add(-window)) {
+		attempt.Failures = 0
+	}
+	attempt.Failures++
+	attempt.LastFailedAt = now
+	return attempt.Failures, nil
+}
+
+func (m *MemoryStore) Lock(kind, value string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if attempt, ok := m.attempts[memoryKey(kind, value)]; ok {
+		attempt.LockedUntil = &until
+	}
+	return nil
+}
+
+func (m *MemoryStore) Clear(kind, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.attempts, memoryKey(kind, value))
+	return nil
+}
+
+func (m *MemoryStore) List() ([]models.LoginAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	attempts := make([]models.LoginAttempt, 0, len(m.attempts))
+	for _, attempt := range m.attempts {
+		attempts = append(attempts, *attempt)
+	}
+	sort.Slice(attempts, func(i, j int) bool {
+		return attempts[i].LastFailedAt.After(attempts[j].LastFailedAt)
+	})
+	return attempts, nil
+}
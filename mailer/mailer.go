@@ -0,0 +1,98 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mailer sends plain text emails, handlers use the package wide Default
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+var (
+	Default Mailer
+
+	ErrNoMailer = errors.New("mailer: no mailer is configured, set smtp_host, mail_file or mail_log_mailer")
+)
+
+// Init picks the SMTP mailer when smtp_host is configured, otherwise mails are appended to mail_file.
+// Without either mails are only logged, which mail_log_mailer has to allow for local runs, otherwise
+// Init fails so that a deployment cannot silently drop its reset and verification mails
+func Init() error {
+	if host := os.Getenv("smtp_host"); host != "" {
+		Default = &SMTPMailer{
+			Host:     host,
+			Port:     os.Getenv("smtp_port"),
+			Username: os.Getenv("smtp_user"),
+			Password: os.Getenv("smtp_password"),
+			From:     os.Getenv("smtp_from"),
+		}
+		return nil
+	}
+	if path := os.Getenv("mail_file"); path != "" {
+		Default = &FileMailer{Path: path}
+		return nil
+	}
+	if os.Getenv("mail_log_mailer") == "true" {
+		logrus.Printf("mailer: mails are only logged and never delivered, never use this in production")
+		Default = LogMailer{}
+		return nil
+	}
+	return ErrNoMailer
+}
+
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	message := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n", m.From, to, subject, body)
+	return smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{to}, []byte(message))
+}
+
+// LogMailer only logs who a mail was for and its subject, the body carries links that must not end up
+// in the log. It is meant for tests and local runs
+type LogMailer struct{}
+
+func (m LogMailer) Send(to, subject, body string) error {
+	logrus.Printf("LogMailer: mail to %s: %s", to, subject)
+	return nil
+}
+
+// FileMailer appends every message to a file so that links can be picked up during development
+type FileMailer struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (m *FileMailer) Send(to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	file, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil {
+			logrus.Printf("FileMailer: unable to close file:%v", closeErr)
+		}
+	}()
+	entry := fmt.Sprintf("Date: %s\nTo: %s\nSubject: %s\n\n%s\n%s\n", time.Now().Format(time.RFC1123Z), to, subject, body, strings.Repeat("-", 40))
+	_, err = file.WriteString(entry)
+	return err
+}
@@ -2,24 +2,35 @@ package middleware
 
 import (
 	"Audiophile/database/helper"
-	"Audiophile/handler"
 	"Audiophile/models"
+	"Audiophile/signing"
 	"Audiophile/utilities"
 	"context"
+	"database/sql"
 	"github.com/dgrijalva/jwt-go"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"net/http"
+	"strings"
 )
 
+// AuthMiddleware authenticates a user session through the token header or, for integrations, an
+// api key sent as "Authorization: Bearer ak_..."
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		token := r.Header.Get("token")
+		if token == "" {
+			apiKey := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer"))
+			if strings.HasPrefix(apiKey, models.APIKeyPrefix) {
+				authenticateAPIKey(w, r, next, apiKey)
+				return
+			}
+		}
 
 		claims := models.Claims{}
 
-		tkn, err1 := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
-			return handler.JwtKey, nil
-		})
+		tkn, err1 := jwt.ParseWithClaims(token, &claims, signing.Keys.Keyfunc)
 		if err1 != nil {
 			if err1 == jwt.ErrSignatureInvalid {
 				logrus.Printf("Signature invalid:%v", err1)
@@ -38,39 +49,246 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		_, err := helper.CheckSession(claims.ID)
+		sessionID, err := uuid.Parse(claims.Id)
 		if err != nil {
-			logrus.Printf("session expired:%v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			logrus.Printf("token has no session:%v", err)
+			return
+		}
+
+		err = helper.CheckSession(sessionID, claims.ID, claims.ImpersonatorID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				w.WriteHeader(http.StatusUnauthorized)
+				logrus.Printf("session expired:%v", err)
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			logrus.Printf("CheckSession:%v", err)
 			return
 		}
 		userID := claims.ID
 		role := claims.Role
 
-		value := models.ContextValues{ID: userID, Role: role}
+		value := models.ContextValues{ID: userID, Role: role, SessionID: sessionID, MFAVerified: claims.MFA}
+		if claims.ImpersonatorID != nil {
+			value.ImpersonatorID = *claims.ImpersonatorID
+		}
 		ctx := context.WithValue(r.Context(), utilities.UserContextKey, value)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		if value.ImpersonatorID == uuid.Nil {
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		// every request of an impersonation session is audited, including the ones refused here
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		if impersonationAllowed(r) {
+			next.ServeHTTP(recorder, r.WithContext(ctx))
+		} else {
+			recorder.WriteHeader(http.StatusForbidden)
+			_, err = recorder.Write([]byte("ERROR: impersonation sessions are read only"))
+			if err != nil {
+				logrus.Printf("AuthMiddleware:%v", err)
+			}
+		}
+
+		err = helper.RecordImpersonatedRequest(value.ImpersonatorID, userID, sessionID, r.Method, r.URL.RequestURI(), recorder.status)
+		if err != nil {
+			logrus.Printf("AuthMiddleware: cannot audit impersonated request:%v", err)
+		}
 	})
 }
 
-func AdminMiddleware(next http.Handler) http.Handler {
+func authenticateAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, apiKey string) {
+	principal, err := helper.UseAPIKey(utilities.HashToken(apiKey))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusUnauthorized)
+			logrus.Printf("api key is invalid")
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.Printf("UseAPIKey:%v", err)
+		return
+	}
+
+	// the key itself is the second factor, CreateAPIKey only issues keys to mfa verified sessions
+	value := models.ContextValues{
+		ID:          principal.CreatedBy,
+		MFAVerified: true,
+		APIKeyID:    principal.ID,
+		Scopes:      principal.Scopes,
+	}
+	ctx := context.WithValue(r.Context(), utilities.UserContextKey, value)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// SessionOnly keeps api keys out of routes that act on the caller's own account
+func SessionOnly(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			logrus.Printf("SessionOnly:Context for ID:%v", ok)
+			return
+		}
+
+		if contextValues.APIKeyID != uuid.Nil {
+			w.WriteHeader(http.StatusForbidden)
+			_, err := w.Write([]byte("ERROR: api keys can only be used on admin endpoints"))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// statusRecorder remembers the status a handler answered with so it can be audited afterwards
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// impersonationRoutes are the only routes an impersonation session may use, reading the customer's bill
+// and profile as they see them and ending its own session, keyed on method and route pattern
+var impersonationRoutes = map[string]bool{
+	http.MethodPost + " /audiophile/auth/bill":   true,
+	http.MethodGet + " /audiophile/auth/me":      true,
+	http.MethodPut + " /audiophile/auth/log-out": true,
+}
 
+// impersonationAllowed matches the request against the router since the middleware runs before the route is resolved
+func impersonationAllowed(r *http.Request) bool {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || rctx.Routes == nil {
+		return false
+	}
+
+	routeContext := chi.NewRouteContext()
+	if !rctx.Routes.Match(routeContext, r.Method, r.URL.Path) {
+		return false
+	}
+	// mounted sub routers answer with and without the trailing slash
+	return impersonationRoutes[r.Method+" "+strings.TrimSuffix(routeContext.RoutePattern(), "/")]
+}
+
+// RequirePermission only lets users through whose roles together grant every one of the permissions,
+// api keys additionally need the permissions among their scopes
+func RequirePermission(permissions ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+			if !ok {
+				w.WriteHeader(http.StatusInternalServerError)
+				logrus.Printf("RequirePermission:Context for ID:%v", ok)
+				return
+			}
+
+			granted, err := helper.FetchUserPermissions(contextValues.ID)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				logrus.Printf("RequirePermission:%v", err)
+				return
+			}
+
+			grantedSet := make(map[string]bool, len(granted))
+			for _, permission := range granted {
+				grantedSet[permission] = true
+			}
+			if contextValues.APIKeyID != uuid.Nil {
+				// a key never grants more than its creator still has
+				scopedSet := make(map[string]bool, len(contextValues.Scopes))
+				for _, scope := range contextValues.Scopes {
+					scopedSet[scope] = grantedSet[scope]
+				}
+				grantedSet = scopedSet
+			}
+
+			for _, permission := range permissions {
+				if !grantedSet[permission] {
+					w.WriteHeader(http.StatusForbidden)
+					logrus.Printf("permission %s missing", permission)
+					_, err = w.Write([]byte("ERROR: Permission denied"))
+					if err != nil {
+						return
+					}
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// MFAPolicyMiddleware blocks sessions that skipped two-factor authentication when one of the user's roles requires it
+func MFAPolicyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
 		if !ok {
 			w.WriteHeader(http.StatusInternalServerError)
-			logrus.Printf("AdminMiddleware:Context for ID:%v", ok)
+			logrus.Printf("MFAPolicyMiddleware:Context for ID:%v", ok)
 			return
 		}
 
-		if contextValues.Role != "admin" {
-			w.WriteHeader(http.StatusUnauthorized)
-			logrus.Printf("Role invalid")
-			_, err := w.Write([]byte("ERROR: Role mismatch"))
+		if contextValues.MFAVerified {
+			next.ServeHTTP(w, r)
+			return
+		}
 
+		mfaRequired, err := helper.IsMFARequiredForUser(contextValues.ID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			logrus.Printf("MFAPolicyMiddleware:%v", err)
+			return
+		}
+
+		if mfaRequired {
+			w.WriteHeader(http.StatusForbidden)
+			logrus.Printf("two-factor authentication required")
+			_, err = w.Write([]byte("ERROR: two-factor authentication required, enroll and log in again"))
 			if err != nil {
 				return
 			}
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// VerifiedEmailMiddleware blocks users that have not verified their email yet
+func VerifiedEmailMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			logrus.Printf("VerifiedEmailMiddleware:Context for ID:%v", ok)
+			return
+		}
+
+		status, err := helper.FetchEmailVerificationStatus(contextValues.ID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			logrus.Printf("VerifiedEmailMiddleware:%v", err)
+			return
+		}
 
+		if !status.Verified {
+			w.WriteHeader(http.StatusForbidden)
+			logrus.Printf("email not verified")
+			_, err = w.Write([]byte("ERROR: please verify your email first"))
+			if err != nil {
+				return
+			}
 			return
 		}
 
@@ -1,33 +1,32 @@
 package middleware
 
 import (
+	"Audiophile/identity"
 	"context"
-	firebase "firebase.google.com/go"
 	"github.com/labstack/echo"
 	"github.com/sirupsen/logrus"
-	"google.golang.org/api/option"
 	"net/http"
-	"os"
 	"strings"
 )
 
 func OAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		opt := option.WithCredentialsJSON([]byte(os.Getenv("firebase_key")))
-		app, err := firebase.NewApp(context.Background(), nil, opt)
+		provider, err := identity.Get(identity.ProviderFirebase)
 		if err != nil {
-			logrus.Printf("OAuth:cannot create firebase application object:%v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			logrus.Printf("OAuth:%v", err)
 			return
 		}
-		auth, err := app.Auth(context.Background())
-		if err != nil {
-			logrus.Printf("OAuth:cannot create auth client:%v", err)
-		}
 
 		header := r.Header.Get(echo.HeaderAuthorization)
 		idToken := strings.TrimSpace(strings.Replace(header, "Bearer", "", 1))
-		_, err = auth.VerifyIDToken(context.Background(), idToken)
+		_, err = provider.Verify(r.Context(), idToken)
 		if err != nil {
+			if err == identity.ErrInvalidToken {
+				w.WriteHeader(http.StatusUnauthorized)
+				logrus.Printf("cannot verify token:%v", err)
+				return
+			}
 			w.WriteHeader(http.StatusInternalServerError)
 			logrus.Printf("cannot verify token:%v", err)
 			return
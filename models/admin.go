@@ -0,0 +1,57 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"time"
+)
+
+const (
+	AuditUserSuspended       = "user.suspended"
+	AuditUserReactivated     = "user.reactivated"
+	AuditUserRoleAdded       = "user.role_added"
+	AuditUserRoleRemoved     = "user.role_removed"
+	AuditUserRolesSet        = "user.roles_set"
+	AuditUserLoggedOut       = "user.logged_out"
+	AuditUserImpersonated    = "user.impersonated"
+	AuditImpersonatedRequest = "impersonation.request"
+)
+
+type AccountStatus struct {
+	Suspended bool   `db:"suspended"`
+	Reason    string `db:"suspension_reason"`
+}
+
+type AdminUserDetails struct {
+	Profile
+	Roles            pq.StringArray  `json:"roles" db:"roles"`
+	SuspendedAt      *time.Time      `json:"suspendedAt" db:"suspended_at"`
+	SuspensionReason string          `json:"suspensionReason" db:"suspension_reason"`
+	Addresses        []ExportAddress `json:"addresses" db:"-"`
+	Orders           []ExportOrder   `json:"orders" db:"-"`
+}
+
+type SuspendUserRequest struct {
+	Reason string `json:"reason"`
+}
+
+type AuditEntry struct {
+	TotalCount   int             `json:"-" db:"total_count"`
+	ID           uuid.UUID       `json:"id" db:"id"`
+	ActorID      uuid.UUID       `json:"actorId" db:"actor_id"`
+	ActorEmail   string          `json:"actorEmail" db:"actor_email"`
+	Action       string          `json:"action" db:"action"`
+	TargetUserID *uuid.UUID      `json:"targetUserId" db:"target_user_id"`
+	Details      json.RawMessage `json:"details" db:"details"`
+	CreatedAt    time.Time       `json:"createdAt" db:"created_at"`
+}
+
+type TotalAuditEntries struct {
+	Entries    []AuditEntry `json:"entries"`
+	TotalCount int          `json:"totalCount"`
+}
+
+type ImpersonationRequest struct {
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"time"
+)
+
+// APIKeyPrefix starts every api key so they are easy to tell apart from jwts and to spot in leaks
+const APIKeyPrefix = "ak_"
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+type APIKey struct {
+	ID         uuid.UUID      `json:"id" db:"id"`
+	Name       string         `json:"name" db:"name"`
+	Prefix     string         `json:"prefix" db:"prefix"`
+	Scopes     pq.StringArray `json:"scopes" db:"scopes"`
+	CreatedBy  uuid.UUID      `json:"createdBy" db:"created_by"`
+	ExpiresAt  *time.Time     `json:"expiresAt" db:"expires_at"`
+	LastUsedAt *time.Time     `json:"lastUsedAt" db:"last_used_at"`
+	RevokedAt  *time.Time     `json:"revokedAt" db:"revoked_at"`
+	CreatedAt  time.Time      `json:"createdAt" db:"created_at"`
+}
+
+// APIKeyPrincipal is what a valid api key authenticates as
+type APIKeyPrincipal struct {
+	ID        uuid.UUID      `db:"id"`
+	CreatedBy uuid.UUID      `db:"created_by"`
+	Scopes    pq.StringArray `db:"scopes"`
+}
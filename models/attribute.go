@@ -0,0 +1,175 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"regexp"
+)
+
+const (
+	AttributeNumber  = "number"
+	AttributeRange   = "range"
+	AttributeText    = "text"
+	AttributeEnum    = "enum"
+	AttributeBoolean = "boolean"
+)
+
+var attributeKeyPattern = regexp.MustCompile(`^[a-z0-9]+(_[a-z0-9]+)*$`)
+
+func IsAttributeKey(key string) bool {
+	return attributeKeyPattern.MatchString(key)
+}
+
+// AttributeDefinition describes one specification of the products in a category and its subcategories,
+// such as impedance in ohm. MinValue and MaxValue bound number and range values, AllowedValues lists
+// the choices of an enum
+type AttributeDefinition struct {
+	ID            uuid.UUID      `json:"id" db:"id"`
+	CategoryID    uuid.UUID      `json:"categoryId" db:"category_id"`
+	Key           string         `json:"key" db:"key"`
+	Name          string         `json:"name" db:"name"`
+	Type          string         `json:"type" db:"type"`
+	Unit          *string        `json:"unit" db:"unit"`
+	AllowedValues pq.StringArray `json:"allowedValues" db:"allowed_values"`
+	MinValue      *float64       `json:"minValue" db:"min_value"`
+	MaxValue      *float64       `json:"maxValue" db:"max_value"`
+	Required      bool           `json:"required" db:"required"`
+}
+
+// Validate checks a new definition is complete for its type
+func (d AttributeDefinition) Validate() error {
+	if !IsAttributeKey(d.Key) {
+		return errors.New("key may only contain lower case letters, digits and single underscores")
+	}
+	if d.Name == "" {
+		return errors.New("name is required")
+	}
+	switch d.Type {
+	case AttributeNumber, AttributeRange, AttributeText, AttributeBoolean:
+		if len(d.AllowedValues) > 0 {
+			return errors.New("only enum attributes have allowed values")
+		}
+	case AttributeEnum:
+		if len(d.AllowedValues) == 0 {
+			return errors.New("enum attributes need allowed values")
+		}
+	default:
+		return errors.New("type must be one of number, range, text, enum or boolean")
+	}
+	if d.MinValue != nil && d.MaxValue != nil && *d.MinValue > *d.MaxValue {
+		return errors.New("minValue is above maxValue")
+	}
+	return nil
+}
+
+// AttributeValue holds a value of one attribute, only the fields of the definition's type are set
+type AttributeValue struct {
+	Number   *float64 `db:"number_value"`
+	RangeMin *float64 `db:"range_min"`
+	RangeMax *float64 `db:"range_max"`
+	Text     *string  `db:"text_value"`
+	Bool     *bool    `db:"bool_value"`
+}
+
+// AttributeRangeValue is how range values are sent and shown, a frequency response of 20 to 20000 Hz
+// is {"min": 20, "max": 20000}
+type AttributeRangeValue struct {
+	Min *float64 `json:"min"`
+	Max *float64 `json:"max"`
+}
+
+// Parse reads the json value of an attribute and checks it against the definition
+func (d AttributeDefinition) Parse(raw json.RawMessage) (AttributeValue, error) {
+	var value AttributeValue
+	invalid := errors.New("invalid value for " + d.Key)
+
+	switch d.Type {
+	case AttributeNumber:
+		if json.Unmarshal(raw, &value.Number) != nil || value.Number == nil || !d.inBounds(*value.Number) {
+			return value, invalid
+		}
+	case AttributeRange:
+		var rangeValue AttributeRangeValue
+		if json.Unmarshal(raw, &rangeValue) != nil || rangeValue.Min == nil || rangeValue.Max == nil ||
+			*rangeValue.Min > *rangeValue.Max || !d.inBounds(*rangeValue.Min) || !d.inBounds(*rangeValue.Max) {
+			return value, invalid
+		}
+		value.RangeMin, value.RangeMax = rangeValue.Min, rangeValue.Max
+	case AttributeText:
+		if json.Unmarshal(raw, &value.Text) != nil || value.Text == nil || *value.Text == "" {
+			return value, invalid
+		}
+	case AttributeEnum:
+		if json.Unmarshal(raw, &value.Text) != nil || value.Text == nil {
+			return value, invalid
+		}
+		for _, allowed := range d.AllowedValues {
+			if allowed == *value.Text {
+				return value, nil
+			}
+		}
+		return value, invalid
+	case AttributeBoolean:
+		if json.Unmarshal(raw, &value.Bool) != nil || value.Bool == nil {
+			return value, invalid
+		}
+	default:
+		return value, invalid
+	}
+	return value, nil
+}
+
+func (d AttributeDefinition) inBounds(number float64) bool {
+	return (d.MinValue == nil || number >= *d.MinValue) && (d.MaxValue == nil || number <= *d.MaxValue)
+}
+
+// ProductAttribute is an attribute value of a product as shown in the catalog
+type ProductAttribute struct {
+	Key   string      `json:"key"`
+	Name  string      `json:"name"`
+	Type  string      `json:"type"`
+	Unit  *string     `json:"unit"`
+	Value interface{} `json:"value"`
+}
+
+// AttributeFilter narrows a listing to products whose attribute key has one of Values or, for numbers,
+// lies between Min and Max. A range attribute matches when it covers Min to Max. The json form is what
+// the listing query reads the filters from
+type AttributeFilter struct {
+	Key    string   `json:"key"`
+	Values []string `json:"one_of"`
+	Min    *float64 `json:"min"`
+	Max    *float64 `json:"max"`
+}
+
+type AttributeFacetValue struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// AttributeFacet counts the products per value of a text, enum or boolean attribute and gives the
+// smallest and largest value of a number or range attribute
+type AttributeFacet struct {
+	Key    string                `json:"key"`
+	Name   string                `json:"name"`
+	Type   string                `json:"type"`
+	Unit   *string               `json:"unit"`
+	Values []AttributeFacetValue `json:"values,omitempty"`
+	Min    *float64              `json:"min,omitempty"`
+	Max    *float64              `json:"max,omitempty"`
+}
+
+// Display returns the value the way it is sent in, as a number, range, string or bool
+func (v AttributeValue) Display(attributeType string) interface{} {
+	switch attributeType {
+	case AttributeNumber:
+		return v.Number
+	case AttributeRange:
+		return AttributeRangeValue{Min: v.RangeMin, Max: v.RangeMax}
+	case AttributeBoolean:
+		return v.Bool
+	}
+	return v.Text
+}
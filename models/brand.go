@@ -0,0 +1,31 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type Brand struct {
+	ID          int        `json:"id" db:"id"`
+	Name        string     `json:"name" db:"name"`
+	Description string     `json:"description" db:"description"`
+	Slug        string     `json:"slug" db:"slug"`
+	LogoImageID *uuid.UUID `json:"logoImageId" db:"logo_image_id"`
+	LogoURL     *string    `json:"logoUrl" db:"logo_url"`
+	CreatedAt   time.Time  `json:"createdAt" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updatedAt" db:"updated_at"`
+	ArchivedAt  *time.Time `json:"archivedAt,omitempty" db:"archived_at"`
+}
+
+// BrandUpdate only changes the fields that are set
+type BrandUpdate struct {
+	BrandName        *string    `json:"brandName"`
+	BrandDescription *string    `json:"brandDescription"`
+	Slug             *string    `json:"slug"`
+	LogoImageID      *uuid.UUID `json:"logoImageId"`
+}
+
+type BrandPage struct {
+	Brand    Brand        `json:"brand"`
+	Products TotalProduct `json:"products"`
+}
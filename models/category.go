@@ -0,0 +1,17 @@
+package models
+
+import "github.com/google/uuid"
+
+type CategoryMove struct {
+	// ParentID is the new parent, nil moves the category to the top level
+	ParentID *uuid.UUID `json:"parentId"`
+}
+
+// CategoryNode is a category of the tree, ProductCount includes the products of its subcategories
+type CategoryNode struct {
+	ID           uuid.UUID       `json:"id" db:"id"`
+	ParentID     *uuid.UUID      `json:"parentId" db:"parent_id"`
+	Name         string          `json:"name" db:"name"`
+	ProductCount int             `json:"productCount" db:"product_count"`
+	Children     []*CategoryNode `json:"children" db:"-"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "github.com/google/uuid"
+
+const (
+	MinCompareProducts = 2
+	MaxCompareProducts = 5
+)
+
+type ComparedProduct struct {
+	ID     uuid.UUID        `json:"id"`
+	Name   string           `json:"name"`
+	Images ProductImageList `json:"images"`
+}
+
+// ComparisonRow holds one property of every compared product, Values lines up with the products and
+// is null where a product has no value. Differs is set when the values are not all the same
+type ComparisonRow struct {
+	Key     string        `json:"key"`
+	Name    string        `json:"name"`
+	Unit    *string       `json:"unit"`
+	Values  []interface{} `json:"values"`
+	Differs bool          `json:"differs"`
+}
+
+type Comparison struct {
+	Products []ComparedProduct `json:"products"`
+	Rows     []ComparisonRow   `json:"rows"`
+}
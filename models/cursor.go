@@ -0,0 +1,32 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+)
+
+// Cursor points at the row a page starts after, or ends before when Before is set. Values are the
+// sort keys of that row, clients only ever see the encoded form
+type Cursor struct {
+	Sort   string          `json:"s"`
+	Values json.RawMessage `json:"v"`
+	Before bool            `json:"b,omitempty"`
+}
+
+func (c Cursor) Encode() string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeCursor(encoded string) (Cursor, error) {
+	var cursor Cursor
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(data, &cursor)
+	return cursor, err
+}
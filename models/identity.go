@@ -0,0 +1,29 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// ExternalIdentity is what an identity provider vouches for after verifying one of its tokens
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	PhoneNumber   string
+}
+
+type LinkIdentityRequest struct {
+	Provider string `json:"provider"`
+	Token    string `json:"token"`
+}
+
+type UserIdentity struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	Provider  string    `json:"provider" db:"provider"`
+	Subject   string    `json:"subject" db:"subject"`
+	Email     string    `json:"email" db:"email"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type LoginAttempt struct {
+	Kind         string     `json:"kind" db:"kind"`
+	Value        string     `json:"value" db:"value"`
+	Failures     int        `json:"failures" db:"failures"`
+	LastFailedAt time.Time  `json:"lastFailedAt" db:"last_failed_at"`
+	LockedUntil  *time.Time `json:"lockedUntil" db:"locked_until"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+)
+
+const PurposeMFAPending = "mfa_pending"
+
+// MFAPendingClaims is carried by the short lived token handed out after the password step of a
+// login for accounts with two-factor authentication, it cannot be used as an access token
+type MFAPendingClaims struct {
+	ID         uuid.UUID `json:"id"`
+	Role       string    `json:"role"`
+	DeviceName string    `json:"deviceName"`
+	Purpose    string    `json:"purpose"`
+	jwt.StandardClaims
+}
+
+type TOTPDetails struct {
+	Secret       string `db:"secret"`
+	Enabled      bool   `db:"enabled"`
+	LastUsedStep int64  `db:"last_used_step"`
+}
+
+type MFACode struct {
+	Code string `json:"code"`
+}
+
+type MFALogin struct {
+	MFAToken     string `json:"mfaToken"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+type MFAPolicy struct {
+	Role     string `json:"role"`
+	Required bool   `json:"required"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type PhoneStatus struct {
+	PhoneNo  string `db:"phone_no"`
+	Verified bool   `db:"verified"`
+}
+
+type OTPSendStats struct {
+	LastSentAt   *time.Time `db:"last_sent_at"`
+	SentInWindow int        `db:"sent_in_window"`
+}
+
+type PhoneOTP struct {
+	ID       uuid.UUID `db:"id"`
+	PhoneNo  string    `db:"phone_no"`
+	CodeHash string    `db:"code_hash"`
+	Attempts int       `db:"attempts"`
+}
+
+type PhoneOTPVerify struct {
+	Code string `json:"code"`
+}
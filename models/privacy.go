@@ -0,0 +1,70 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	ExportFormatJSON = "json"
+	ExportFormatZIP  = "zip"
+)
+
+type ExportAddress struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	Address   string     `json:"address" db:"address"`
+	CreatedAt time.Time  `json:"createdAt" db:"created_at"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty" db:"archived_at"`
+}
+
+type ExportCartItem struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	ProductID   *uuid.UUID `json:"productId" db:"product_id"`
+	ProductName string     `json:"productName" db:"product_name"`
+	Quantity    int        `json:"quantity" db:"quantity"`
+	TotalAmount float64    `json:"totalAmount" db:"total_amount"`
+	Ordered     bool       `json:"ordered" db:"ordered"`
+	CreatedAt   time.Time  `json:"createdAt" db:"created_at"`
+	RemovedAt   *time.Time `json:"removedAt,omitempty" db:"archived_at"`
+}
+
+type ExportOrder struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	AddressID   *uuid.UUID `json:"addressId" db:"address_id"`
+	TotalAmount float64    `json:"totalAmount" db:"total_amount"`
+	Status      string     `json:"status" db:"status"`
+	CreatedAt   time.Time  `json:"createdAt" db:"created_at"`
+}
+
+type ExportPayment struct {
+	ID            uuid.UUID  `json:"id" db:"id"`
+	OrderID       *uuid.UUID `json:"orderId" db:"order_id"`
+	PaymentType   string     `json:"paymentType" db:"payment_type"`
+	Name          string     `json:"name" db:"name"`
+	AccountNumber int        `json:"accountNumber" db:"account_number"`
+}
+
+type ExportBill struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	PaymentID *uuid.UUID `json:"paymentId" db:"payment_id"`
+	OrderID   *uuid.UUID `json:"orderId" db:"order_id"`
+}
+
+// DataExport is everything we keep about a user, handed out on request
+type DataExport struct {
+	ExportedAt time.Time        `json:"exportedAt"`
+	Profile    Profile          `json:"profile"`
+	Addresses  []ExportAddress  `json:"addresses"`
+	Carts      []ExportCartItem `json:"carts"`
+	Orders     []ExportOrder    `json:"orders"`
+	Payments   []ExportPayment  `json:"payments"`
+	Bills      []ExportBill     `json:"bills"`
+}
+
+// DeleteAccountRequest is confirmed with the password or, for accounts without one, a new token of a
+// linked identity provider
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+	Provider string `json:"provider"`
+	Token    string `json:"token"`
+}
@@ -0,0 +1,158 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	StockInStock    = "in_stock"
+	StockLow        = "low_stock"
+	StockOutOfStock = "out_of_stock"
+
+	// LowStockThreshold is the quantity at or below which a product is shown as running low
+	LowStockThreshold = 5
+)
+
+func StockStatus(quantity int) string {
+	switch {
+	case quantity <= 0:
+		return StockOutOfStock
+	case quantity <= LowStockThreshold:
+		return StockLow
+	}
+	return StockInStock
+}
+
+// the sort keys of the product listing, every order ends on the product id so pages never overlap.
+// Relevance is the default when searching by name
+const (
+	SortRelevance   = "relevance"
+	SortName        = "name"
+	SortPriceAsc    = "price_asc"
+	SortPriceDesc   = "price_desc"
+	SortNewest      = "newest"
+	SortBestSelling = "best_selling"
+	SortTopRated    = "top_rated"
+)
+
+func IsProductSort(sort string) bool {
+	switch sort {
+	case SortRelevance, SortName, SortPriceAsc, SortPriceDesc, SortNewest, SortBestSelling, SortTopRated:
+		return true
+	}
+	return false
+}
+
+// ProductRating is a 1 to 5 star rating, users can rate products they have a completed order of
+type ProductRating struct {
+	Rating int `json:"rating"`
+}
+
+type ProductImage struct {
+	// ID is the images_per_product row, the one DeleteProductImage takes
+	ID       uuid.UUID `json:"id"`
+	ImageID  uuid.UUID `json:"imageId"`
+	URL      string    `json:"url"`
+	Position int       `json:"position"`
+}
+
+// ProductImageList scans the json array the product queries aggregate the images of a product into
+type ProductImageList []ProductImage
+
+func (l *ProductImageList) Scan(src interface{}) error {
+	var data []byte
+	switch value := src.(type) {
+	case []byte:
+		data = value
+	case string:
+		data = []byte(value)
+	case nil:
+		*l = make(ProductImageList, 0)
+		return nil
+	default:
+		return fmt.Errorf("ProductImageList: cannot scan %T", src)
+	}
+	images := make(ProductImageList, 0)
+	if err := json.Unmarshal(data, &images); err != nil {
+		return err
+	}
+	*l = images
+	return nil
+}
+
+type ProductCategory struct {
+	ID   *uuid.UUID `json:"id" db:"id"`
+	Name string     `json:"name" db:"name"`
+}
+
+type ProductBrand struct {
+	ID          *int   `json:"id" db:"id"`
+	Name        string `json:"name" db:"name"`
+	Description string `json:"description" db:"description"`
+}
+
+type ProductDetail struct {
+	ID                 uuid.UUID          `json:"id" db:"id"`
+	Name               string             `json:"name" db:"name"`
+	ProductDescription string             `json:"productDescription" db:"product_description"`
+	Price              float64            `json:"price" db:"price"`
+	Quantity           int                `json:"quantity" db:"quantity"`
+	StockStatus        string             `json:"stockStatus" db:"-"`
+	Category           ProductCategory    `json:"category" db:"category"`
+	Brand              ProductBrand       `json:"brand" db:"brand"`
+	Images             ProductImageList   `json:"images" db:"images"`
+	Attributes         []ProductAttribute `json:"attributes" db:"-"`
+	CreatedAt          time.Time          `json:"createdAt" db:"created_at"`
+	UpdatedAt          time.Time          `json:"updatedAt" db:"updated_at"`
+}
+
+type BrandFacet struct {
+	ID    int    `json:"id" db:"id"`
+	Name  string `json:"name" db:"name"`
+	Count int    `json:"count" db:"count"`
+}
+
+type CategoryFacet struct {
+	ID    uuid.UUID `json:"id" db:"id"`
+	Name  string    `json:"name" db:"name"`
+	Count int       `json:"count" db:"count"`
+}
+
+type PriceRange struct {
+	Min float64 `json:"min" db:"min"`
+	Max float64 `json:"max" db:"max"`
+}
+
+// ProductFacets counts the products per filter value, each facet applies every selected filter
+// except its own so the storefront can offer the other values of it
+type ProductFacets struct {
+	Brands     []BrandFacet     `json:"brands"`
+	Categories []CategoryFacet  `json:"categories"`
+	PriceRange PriceRange       `json:"priceRange"`
+	InStock    int              `json:"inStock"`
+	Attributes []AttributeFacet `json:"attributes"`
+}
+
+type ProductSuggestion struct {
+	ID   uuid.UUID `json:"id" db:"id"`
+	Name string    `json:"name" db:"name"`
+}
+
+type BrandSuggestion struct {
+	ID   int    `json:"id" db:"id"`
+	Name string `json:"name" db:"name"`
+}
+
+type CategorySuggestion struct {
+	ID   uuid.UUID `json:"id" db:"id"`
+	Name string    `json:"name" db:"name"`
+}
+
+type Suggestions struct {
+	Products   []ProductSuggestion  `json:"products"`
+	Brands     []BrandSuggestion    `json:"brands"`
+	Categories []CategorySuggestion `json:"categories"`
+}
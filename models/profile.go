@@ -0,0 +1,38 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type Profile struct {
+	ID            uuid.UUID `json:"id" db:"id"`
+	Name          string    `json:"name" db:"name"`
+	Email         string    `json:"email" db:"email"`
+	PhoneNo       string    `json:"phoneNo" db:"phone_no"`
+	Age           int       `json:"age" db:"age"`
+	EmailVerified bool      `json:"emailVerified" db:"email_verified"`
+	PhoneVerified bool      `json:"phoneVerified" db:"phone_verified"`
+	CreatedAt     time.Time `json:"createdAt" db:"created_at"`
+}
+
+// ProfileUpdate holds the editable fields of models.Users, fields left out of the request stay unchanged
+type ProfileUpdate struct {
+	Name    *string `json:"name"`
+	PhoneNo *string `json:"phoneNo"`
+	Age     *int    `json:"age"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// ChangeEmailRequest is confirmed with the password or, for accounts without one, a new token of a
+// linked identity provider
+type ChangeEmailRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Provider string `json:"provider"`
+	Token    string `json:"token"`
+}
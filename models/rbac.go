@@ -0,0 +1,48 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"time"
+)
+
+const (
+	PermissionUsersRead        = "users.read"
+	PermissionUsersManage      = "users.manage"
+	PermissionUsersImpersonate = "users.impersonate"
+	PermissionInventoryRead    = "inventory.read"
+	PermissionInventoryWrite   = "inventory.write"
+	PermissionOrdersRead       = "orders.read"
+	PermissionSecurityManage   = "security.manage"
+	PermissionRolesManage      = "roles.manage"
+)
+
+type Permission struct {
+	Name        string `json:"name" db:"name"`
+	Description string `json:"description" db:"description"`
+}
+
+type RoleDefinition struct {
+	Name        string         `json:"name" db:"name"`
+	Description string         `json:"description" db:"description"`
+	Permissions pq.StringArray `json:"permissions" db:"permissions"`
+}
+
+type UserRoles struct {
+	Roles []string `json:"roles"`
+}
+
+type AdminOrder struct {
+	TotalCount  int       `json:"-" db:"total_count"`
+	ID          uuid.UUID `json:"id" db:"id"`
+	UserID      uuid.UUID `json:"userId" db:"user_id"`
+	AddressID   uuid.UUID `json:"addressId" db:"address_id"`
+	TotalAmount float64   `json:"totalAmount" db:"total_amount"`
+	Status      string    `json:"status" db:"status"`
+	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
+}
+
+type TotalOrders struct {
+	Orders     []AdminOrder `json:"orders"`
+	TotalCount int          `json:"totalCount"`
+}
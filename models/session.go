@@ -0,0 +1,39 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type SessionDevice struct {
+	Role        string
+	DeviceName  string
+	UserAgent   string
+	IPAddress   string
+	MFAVerified bool
+}
+
+type RefreshTokenDetails struct {
+	ID               uuid.UUID  `db:"id"`
+	SessionID        uuid.UUID  `db:"session_id"`
+	UserID           uuid.UUID  `db:"user_id"`
+	Role             string     `db:"role"`
+	MFAVerified      bool       `db:"mfa_verified"`
+	ExpiresAt        time.Time  `db:"expires_at"`
+	UsedAt           *time.Time `db:"used_at"`
+	SessionExpiresAt time.Time  `db:"session_expires_at"`
+}
+
+type SessionDetails struct {
+	ID         uuid.UUID `json:"id" db:"id"`
+	DeviceName string    `json:"deviceName" db:"device_name"`
+	UserAgent  string    `json:"userAgent" db:"user_agent"`
+	IPAddress  string    `json:"ipAddress" db:"ip_address"`
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt  time.Time `json:"updatedAt" db:"updated_at"`
+	Current    bool      `json:"current" db:"-"`
+}
@@ -1,8 +1,10 @@
 package models
 
 import (
+	"encoding/json"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"time"
 )
 
@@ -14,8 +16,17 @@ const (
 )
 
 type ContextValues struct {
-	ID   uuid.UUID `json:"id"`
-	Role string    `json:"role"`
+	ID uuid.UUID `json:"id"`
+	// Role is only for display, permissions are checked with middleware.RequirePermission
+	Role        string    `json:"role"`
+	SessionID   uuid.UUID `json:"sessionId"`
+	MFAVerified bool      `json:"mfaVerified"`
+	// ImpersonatorID is the admin acting as the user ID, uuid.Nil for the user's own sessions
+	ImpersonatorID uuid.UUID `json:"impersonatorId"`
+	// APIKeyID is set when the request authenticated with an api key, ID is then the admin who
+	// created it and Scopes limits what the key may do
+	APIKeyID uuid.UUID `json:"apiKeyId"`
+	Scopes   []string  `json:"scopes"`
 }
 
 type UserCredentials struct {
@@ -27,13 +38,17 @@ type UserCredentials struct {
 type UsersLoginDetails struct {
 	Email      string `json:"email"`
 	Password   string `json:"password"`
-	Role       string `json:"role"`
 	OauthToken string `json:"oauthToken"`
+	Provider   string `json:"provider"`
+	DeviceName string `json:"deviceName"`
 }
 
 type Claims struct {
-	ID   uuid.UUID `json:"id"`
-	Role string    `json:"role"`
+	ID uuid.UUID `json:"id"`
+	// Role lists the roles of the user when the session started, it is only for display
+	Role           string     `json:"role"`
+	MFA            bool       `json:"mfa,omitempty"`
+	ImpersonatorID *uuid.UUID `json:"impersonatorId,omitempty"`
 	jwt.StandardClaims
 }
 
@@ -53,28 +68,44 @@ type FiltersCheck struct {
 	SearchedName string
 	Limit        int
 	Page         int
+	// the catalog filters below are only read by the product listing, empty means not filtered
+	BrandIDs    pq.Int64Array
+	CategoryIDs pq.StringArray
+	MinPrice    *float64
+	MaxPrice    *float64
+	InStock     bool
+	Sort        string
+	Attributes  []AttributeFilter
+	// Cursor and WithTotal are only read by the product and user listings
+	Cursor    *Cursor
+	WithTotal bool
 }
 
 type UserDetails struct {
-	TotalCount int       `json:"-" db:"total_count"`
-	ID         uuid.UUID `json:"id" db:"id"`
-	Name       string    `json:"name" db:"name"`
-	Email      string    `json:"email" db:"email"`
-	Password   string    `json:"password" db:"password"`
-	PhoneNo    string    `json:"phoneNo" db:"phone_no"`
-	Age        int       `json:"age" db:"age"`
-	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt  time.Time `json:"updatedAt" db:"updated_at"`
-	Address    string    `json:"address" db:"address"`
-	Role       string    `json:"role"  db:"role"`
+	SortKeys  string    `json:"-" db:"sort_keys"`
+	ID        uuid.UUID `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	Email     string    `json:"email" db:"email"`
+	Password  string    `json:"password" db:"password"`
+	PhoneNo   string    `json:"phoneNo" db:"phone_no"`
+	Age       int       `json:"age" db:"age"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
+	Address   string    `json:"address" db:"address"`
+	Role      string    `json:"role"  db:"role"`
 }
 type TotalUser struct {
 	UserDetails []UserDetails
-	TotalCount  int `json:"totalCount" db:"total_count"`
+	// TotalCount is only counted when asked for with total=true
+	TotalCount *int   `json:"totalCount,omitempty"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	PrevCursor string `json:"prevCursor,omitempty"`
 }
 
 type Categories struct {
 	Name string `json:"name"`
+	// ParentID places the category under another one, nil makes it a top level category
+	ParentID *uuid.UUID `json:"parentId"`
 }
 
 type Product struct {
@@ -84,29 +115,36 @@ type Product struct {
 	Quantity           int       `json:"quantity"`
 	BrandID            int       `json:"brandId"`
 	ProductDescription string    `json:"productDescription"`
+	// Attributes maps the keys of the category's attribute definitions to their values
+	Attributes map[string]json.RawMessage `json:"attributes"`
 }
 
 type ProductDetails struct {
-	TotalCount int       `json:"-" db:"total_count"`
-	ID         uuid.UUID `json:"id" db:"id"`
-	Name       string    `json:"name" db:"name"`
-	CategoryID uuid.UUID `json:"categoryId" db:"category_id"`
-	Price      float64   `json:"price" db:"price"`
-	Quantity   int       `json:"quantity" db:"quantity"`
-	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt  time.Time `json:"updatedAt" db:"updated_at"`
-	ImageID    uuid.UUID `json:"imageId" db:"image_id"`
-	ProductID  uuid.UUID `json:"productId" db:"product_id"`
-	URL        string    `json:"url" db:"url"`
+	SortKeys    string           `json:"-" db:"sort_keys"`
+	ID          uuid.UUID        `json:"id" db:"id"`
+	Name        string           `json:"name" db:"name"`
+	CategoryID  uuid.UUID        `json:"categoryId" db:"category_id"`
+	Price       float64          `json:"price" db:"price"`
+	Quantity    int              `json:"quantity" db:"quantity"`
+	StockStatus string           `json:"stockStatus" db:"-"`
+	CreatedAt   time.Time        `json:"createdAt" db:"created_at"`
+	UpdatedAt   time.Time        `json:"updatedAt" db:"updated_at"`
+	Images      ProductImageList `json:"images" db:"images"`
 }
 type ProductUpdateDetails struct {
 	Name     string  `json:"name" db:"name"`
 	Price    float64 `json:"price" db:"price"`
 	Quantity int     `json:"quantity" db:"quantity"`
+	// Attributes sets the given attribute values, null removes one
+	Attributes map[string]json.RawMessage `json:"attributes" db:"-"`
 }
 type TotalProduct struct {
 	ProductDetails []ProductDetails
-	TotalCount     int `json:"totalCount" db:"total_count"`
+	// TotalCount is only counted when asked for with total=true
+	TotalCount *int           `json:"totalCount,omitempty"`
+	NextCursor string         `json:"nextCursor,omitempty"`
+	PrevCursor string         `json:"prevCursor,omitempty"`
+	Facets     *ProductFacets `json:"facets,omitempty"`
 }
 
 type ProductImages struct {
@@ -125,6 +163,9 @@ type OrderDetails struct {
 	TotalAmount float64   `json:"totalAmount"`
 }
 
+// PaymentTypeCOD is cash on delivery, it is only offered to users with a verified phone number
+const PaymentTypeCOD = "cod"
+
 type PaymentDetails struct {
 	Name          string `json:"name"`
 	PaymentType   string `json:"paymentType"`
@@ -144,4 +185,7 @@ type Quantity struct {
 type Brands struct {
 	BrandName        string `json:"brandName"`
 	BrandDescription string `json:"brandDescription"`
+	// Slug is derived from the brand name when left empty
+	Slug        string     `json:"slug"`
+	LogoImageID *uuid.UUID `json:"logoImageId"`
 }
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+)
+
+const (
+	PurposeEmailVerification = "email_verification"
+	PurposeEmailChange       = "email_change"
+)
+
+type EmailVerificationClaims struct {
+	ID      uuid.UUID `json:"id"`
+	Email   string    `json:"email"`
+	Purpose string    `json:"purpose"`
+	// PreviousEmail is only set on email change links, they stop working once the address changed again
+	PreviousEmail string `json:"previousEmail,omitempty"`
+	jwt.StandardClaims
+}
+
+type EmailVerificationStatus struct {
+	Email    string `db:"email"`
+	Verified bool   `db:"verified"`
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"Audiophile/handler"
 	"Audiophile/middleware"
+	"Audiophile/models"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"net/http"
@@ -24,33 +25,117 @@ func SetupRoutes() *Server {
 			})
 		})
 		audiophile.Get("/", handler.ViewProducts)
+		audiophile.Get("/products/suggestions", handler.GetSuggestions)
+		audiophile.Get("/products/compare", handler.CompareProducts)
+		audiophile.Get("/categories", handler.GetCategories)
+		audiophile.Get("/categories/{categoryID}/attributes", handler.GetCategoryAttributes)
+		audiophile.Get("/brands", handler.GetBrands)
+		audiophile.Get("/brands/{slug}", handler.GetBrandPage)
+		audiophile.Get("/products/{productID}", handler.GetProduct)
+		audiophile.Get("/.well-known/jwks.json", handler.JWKS)
 		audiophile.Post("/register", handler.Register)
 		audiophile.Post("/log-in", handler.Login)
+		audiophile.Post("/log-in/mfa", handler.LoginMFA)
 		audiophile.Put("/log-out", handler.Logout)
+		audiophile.Post("/refresh-token", handler.RefreshToken)
+		audiophile.Post("/password-reset", handler.RequestPasswordReset)
+		audiophile.Post("/password-reset/confirm", handler.ConfirmPasswordReset)
+		audiophile.Get("/verify-email", handler.VerifyEmail)
+		audiophile.Get("/verify-email/change", handler.ConfirmEmailChange)
 		audiophile.Route("/auth", func(auth chi.Router) {
 			auth.Use(middleware.AuthMiddleware)
-			auth.Post("/address", handler.AddAddress)
-			auth.Post("/{productID}/cart", handler.AddToCart)
-			auth.Delete("/{cartID}/cart", handler.RemoveFromCart)
-			auth.Post("/image", handler.UploadImage)
-			auth.Post("/", handler.SelectProduct)
-			auth.Post("/checkout", handler.CheckOut)
-			auth.Post("/{orderID}/payment", handler.InstantPayment)
-			auth.Post("/bill", handler.ViewBillDetails)
-			auth.Put("/log-out", handler.Logout)
+			auth.Group(func(user chi.Router) {
+				user.Use(middleware.SessionOnly)
+				user.Post("/address", handler.AddAddress)
+				user.Post("/{productID}/cart", handler.AddToCart)
+				user.Delete("/{cartID}/cart", handler.RemoveFromCart)
+				user.Put("/{productID}/rating", handler.RateProduct)
+				user.Post("/image", handler.UploadImage)
+				user.Post("/", handler.SelectProduct)
+				user.With(middleware.VerifiedEmailMiddleware).Post("/checkout", handler.CheckOut)
+				user.With(middleware.VerifiedEmailMiddleware).Post("/{orderID}/payment", handler.InstantPayment)
+				user.Post("/bill", handler.ViewBillDetails)
+				user.Put("/log-out", handler.Logout)
+				user.Get("/sessions", handler.GetSessions)
+				user.Delete("/sessions/{sessionID}", handler.RevokeSession)
+				user.Post("/verify-email/resend", handler.ResendVerificationEmail)
+				user.Route("/me", func(me chi.Router) {
+					me.Get("/", handler.GetProfile)
+					me.Patch("/", handler.UpdateProfile)
+					me.Delete("/", handler.DeleteAccount)
+					me.Get("/export", handler.ExportData)
+					me.Put("/password", handler.ChangePassword)
+					me.Post("/email", handler.ChangeEmail)
+					me.Post("/phone/otp", handler.SendPhoneOTP)
+					me.Post("/phone/verify", handler.VerifyPhoneOTP)
+				})
+				user.Route("/identities", func(identities chi.Router) {
+					identities.Get("/", handler.GetIdentities)
+					identities.Post("/", handler.LinkIdentity)
+					identities.Delete("/{identityID}", handler.UnlinkIdentity)
+				})
+				user.Route("/mfa/totp", func(mfa chi.Router) {
+					mfa.Post("/enroll", handler.EnrollTOTP)
+					mfa.Post("/confirm", handler.ConfirmTOTP)
+					mfa.Delete("/", handler.DisableTOTP)
+				})
+			})
 			auth.Route("/admin", func(admin chi.Router) {
-				admin.Use(middleware.AdminMiddleware)
-				admin.Get("/users", handler.GetUsers)
-				admin.Post("/category", handler.AddCategory)
-				admin.Post("/brand", handler.AddBrands)
-				admin.Post("/inventory", handler.AddProduct)
-				admin.Get("/products", handler.ViewProducts)
-				admin.Route("/{productID}", func(product chi.Router) {
-					product.Post("/product-images", handler.AddProductImages)
-					product.Put("/", handler.UpdateProduct)
-					product.Delete("/", handler.DeleteProduct)
+				admin.Use(middleware.MFAPolicyMiddleware)
+				admin.With(middleware.RequirePermission(models.PermissionUsersRead)).Get("/users", handler.GetUsers)
+				admin.With(middleware.RequirePermission(models.PermissionUsersRead)).Get("/users/{userID}", handler.GetUserDetails)
+				admin.Group(func(users chi.Router) {
+					users.Use(middleware.RequirePermission(models.PermissionUsersManage))
+					users.Put("/users/{userID}/suspend", handler.SuspendUser)
+					users.Put("/users/{userID}/reactivate", handler.ReactivateUser)
+					users.Post("/users/{userID}/log-out", handler.ForceLogout)
+					users.Get("/audit-log", handler.GetAuditLog)
+				})
+				admin.With(middleware.SessionOnly, middleware.RequirePermission(models.PermissionUsersImpersonate)).Post("/users/{userID}/impersonate", handler.ImpersonateUser)
+				admin.With(middleware.RequirePermission(models.PermissionOrdersRead)).Get("/orders", handler.GetOrders)
+				admin.Group(func(security chi.Router) {
+					security.Use(middleware.RequirePermission(models.PermissionSecurityManage))
+					security.Put("/mfa-policy", handler.SetMFAPolicy)
+					security.Get("/lockouts", handler.GetLockouts)
+					security.Delete("/lockouts", handler.ClearLockout)
+					security.With(middleware.SessionOnly).Get("/api-keys", handler.GetAPIKeys)
+					security.With(middleware.SessionOnly).Post("/api-keys", handler.CreateAPIKey)
+					security.With(middleware.SessionOnly).Delete("/api-keys/{keyID}", handler.RevokeAPIKey)
+				})
+				admin.Group(func(roles chi.Router) {
+					roles.Use(middleware.RequirePermission(models.PermissionRolesManage))
+					roles.Get("/permissions", handler.GetPermissions)
+					roles.Get("/roles", handler.GetRoles)
+					roles.Post("/roles", handler.AddRole)
+					roles.Put("/roles/{role}", handler.UpdateRole)
+					roles.Delete("/roles/{role}", handler.DeleteRole)
+					roles.Put("/users/{userID}/roles", handler.SetUserRoles)
+					roles.Post("/users/{userID}/roles/{role}", handler.AddUserRole)
+					roles.Delete("/users/{userID}/roles/{role}", handler.RemoveUserRole)
+				})
+				admin.With(middleware.RequirePermission(models.PermissionInventoryRead)).Get("/products", handler.ViewProducts)
+				admin.With(middleware.RequirePermission(models.PermissionInventoryRead)).Get("/brands", handler.GetAllBrands)
+				admin.Group(func(inventory chi.Router) {
+					inventory.Use(middleware.RequirePermission(models.PermissionInventoryWrite))
+					inventory.Post("/category", handler.AddCategory)
+					inventory.Route("/category/{categoryID}", func(category chi.Router) {
+						category.Put("/", handler.RenameCategory)
+						category.Put("/parent", handler.MoveCategory)
+						category.Delete("/", handler.ArchiveCategory)
+						category.Post("/attributes", handler.AddAttributeDefinition)
+						category.Delete("/attributes/{key}", handler.ArchiveAttributeDefinition)
+					})
+					inventory.Post("/brand", handler.AddBrands)
+					inventory.Put("/brand/{brandID}", handler.UpdateBrand)
+					inventory.Delete("/brand/{brandID}", handler.ArchiveBrand)
+					inventory.Post("/inventory", handler.AddProduct)
+					inventory.Route("/{productID}", func(product chi.Router) {
+						product.Post("/product-images", handler.AddProductImages)
+						product.Put("/", handler.UpdateProduct)
+						product.Delete("/", handler.DeleteProduct)
+					})
+					inventory.Delete("/{productImageID}", handler.DeleteProductImage)
 				})
-				admin.Delete("/{productImageID}", handler.DeleteProductImage)
 			})
 		})
 	})
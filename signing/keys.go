@@ -0,0 +1,217 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/sirupsen/logrus"
+	"math/big"
+	"sort"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+
+	// devKeyID and devSecretKey sign tokens only when jwt_dev_key opts into them for local setups
+	devKeyID     = "dev"
+	devSecretKey = "dev_secret_key"
+)
+
+var (
+	Keys *KeySet
+
+	ErrUnknownKey       = errors.New("token is signed with an unknown key")
+	ErrNoKeys           = errors.New("signing: jwt_keys is not set")
+	ErrAlgorithmInvalid = errors.New("token algorithm does not match its key")
+)
+
+// KeyConfig is one entry of the jwt_keys configuration, secret is used by HS256 keys and
+// privateKey holds a PEM encoded key for RS256 and EdDSA
+type KeyConfig struct {
+	ID         string `json:"kid"`
+	Algorithm  string `json:"alg"`
+	Secret     string `json:"secret"`
+	PrivateKey string `json:"privateKey"`
+}
+
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// KeySet holds every key that tokens may still be signed with, only the active key is used to sign
+type KeySet struct {
+	active *Key
+	keys   map[string]*Key
+}
+
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Init loads the key set from the jwt_keys json configuration and makes it the package wide Keys. An
+// empty configuration is refused unless devKey opts into a fixed HS256 secret for local setups
+func Init(config, activeKeyID string, devKey bool) error {
+	if config == "" && devKey {
+		logrus.Printf("signing: jwt_dev_key is set, signing with the development key")
+		config = fmt.Sprintf(`[{"kid": %q, "alg": %q, "secret": %q}]`, devKeyID, AlgorithmHS256, devSecretKey)
+		activeKeyID = devKeyID
+	}
+	keySet, err := Load(config, activeKeyID)
+	if err != nil {
+		return err
+	}
+	Keys = keySet
+	return nil
+}
+
+func Load(config, activeKeyID string) (*KeySet, error) {
+	if config == "" {
+		return nil, ErrNoKeys
+	}
+	keyConfigs := make([]KeyConfig, 0)
+	if err := json.Unmarshal([]byte(config), &keyConfigs); err != nil {
+		return nil, fmt.Errorf("signing: cannot parse jwt_keys: %v", err)
+	}
+	if len(keyConfigs) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	keySet := &KeySet{keys: make(map[string]*Key)}
+	for _, keyConfig := range keyConfigs {
+		key, err := parseKey(keyConfig)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := keySet.keys[key.ID]; exists {
+			return nil, fmt.Errorf("signing: duplicate kid %q", key.ID)
+		}
+		keySet.keys[key.ID] = key
+	}
+
+	if activeKeyID == "" {
+		activeKeyID = keyConfigs[0].ID
+	}
+	active, ok := keySet.keys[activeKeyID]
+	if !ok {
+		return nil, fmt.Errorf("signing: active kid %q is not configured", activeKeyID)
+	}
+	keySet.active = active
+	return keySet, nil
+}
+
+func parseKey(keyConfig KeyConfig) (*Key, error) {
+	if keyConfig.ID == "" {
+		return nil, errors.New("signing: every key needs a kid")
+	}
+	key := &Key{ID: keyConfig.ID}
+	switch keyConfig.Algorithm {
+	case AlgorithmHS256:
+		if keyConfig.Secret == "" {
+			return nil, fmt.Errorf("signing: key %q has no secret", keyConfig.ID)
+		}
+		key.Method = jwt.SigningMethodHS256
+		key.signKey = []byte(keyConfig.Secret)
+		key.verifyKey = key.signKey
+	case AlgorithmRS256:
+		privateKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(keyConfig.PrivateKey))
+		if err != nil {
+			return nil, fmt.Errorf("signing: key %q: %v", keyConfig.ID, err)
+		}
+		key.Method = jwt.SigningMethodRS256
+		key.signKey = privateKey
+		key.verifyKey = &privateKey.PublicKey
+	case AlgorithmEdDSA:
+		block, _ := pem.Decode([]byte(keyConfig.PrivateKey))
+		if block == nil {
+			return nil, fmt.Errorf("signing: key %q is not PEM encoded", keyConfig.ID)
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("signing: key %q: %v", keyConfig.ID, err)
+		}
+		privateKey, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("signing: key %q: %v", keyConfig.ID, errInvalidEdDSAKey)
+		}
+		key.Method = SigningMethodEdDSA
+		key.signKey = privateKey
+		key.verifyKey = privateKey.Public()
+	default:
+		return nil, fmt.Errorf("signing: key %q has unsupported alg %q", keyConfig.ID, keyConfig.Algorithm)
+	}
+	return key, nil
+}
+
+// Sign signs the claims with the active key and records its kid in the token header
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.Method, claims)
+	token.Header["kid"] = ks.active.ID
+	return token.SignedString(ks.active.signKey)
+}
+
+// Keyfunc picks the verification key from the kid header and is meant to be passed to jwt.ParseWithClaims,
+// tokens without a kid are refused
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	keyID, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[keyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, ErrAlgorithmInvalid
+	}
+	return key.verifyKey, nil
+}
+
+// JWKS returns the public half of every asymmetric key, HS256 secrets are never published
+func (ks *KeySet) JWKS() JWKSet {
+	jwkSet := JWKSet{Keys: make([]JWK, 0)}
+	for _, key := range ks.keys {
+		switch publicKey := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwkSet.Keys = append(jwkSet.Keys, JWK{
+				KeyType:   "RSA",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: key.Method.Alg(),
+				N:         base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwkSet.Keys = append(jwkSet.Keys, JWK{
+				KeyType:   "OKP",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: key.Method.Alg(),
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(publicKey),
+			})
+		}
+	}
+	sort.Slice(jwkSet.Keys, func(i, j int) bool {
+		return jwkSet.Keys[i].KeyID < jwkSet.Keys[j].KeyID
+	})
+	return jwkSet
+}
@@ -0,0 +1,83 @@
+package sms
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SMSSender sends plain text messages to a phone number, handlers use the package wide Default
+type SMSSender interface {
+	Send(to, message string) error
+}
+
+// codePattern finds the one-time codes in a message so that they can be masked in the log
+var codePattern = regexp.MustCompile(`\d{4,}`)
+
+// Default is nil while no sender is configured, phone verification is unavailable then
+var Default SMSSender
+
+// Init appends messages to sms_file when it is set, sms_log_sender only logs them with the codes masked.
+// Without either phone verification stays disabled until we sign up with a gateway, which gets its own
+// SMSSender picked here
+func Init() {
+	if path := os.Getenv("sms_file"); path != "" {
+		Default = &FileSender{Path: path}
+		return
+	}
+	if os.Getenv("sms_log_sender") == "true" {
+		logrus.Printf("sms: messages are only logged, never use this in production")
+		Default = LogSender{}
+		return
+	}
+	logrus.Printf("sms: no sender is configured, phone verification is disabled")
+}
+
+// Enabled tells whether a sender is configured
+func Enabled() bool {
+	return Default != nil
+}
+
+// LogSender logs every message it is asked to send with its codes and most of the number masked, it
+// is meant for tests and local runs
+type LogSender struct{}
+
+func (s LogSender) Send(to, message string) error {
+	logrus.Printf("LogSender: sms to %s: %s", maskPhone(to), codePattern.ReplaceAllString(message, "******"))
+	return nil
+}
+
+// maskPhone keeps the last four digits of a number
+func maskPhone(phoneNo string) string {
+	if len(phoneNo) <= 4 {
+		return strings.Repeat("*", len(phoneNo))
+	}
+	return strings.Repeat("*", len(phoneNo)-4) + phoneNo[len(phoneNo)-4:]
+}
+
+// FileSender appends every message to a file so that codes can be picked up during development
+type FileSender struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (s *FileSender) Send(to, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil {
+			logrus.Printf("FileSender: unable to close file:%v", closeErr)
+		}
+	}()
+	entry := fmt.Sprintf("Date: %s\nTo: %s\n\n%s\n%s\n", time.Now().Format(time.RFC1123Z), to, message, strings.Repeat("-", 40))
+	_, err = file.WriteString(entry)
+	return err
+}
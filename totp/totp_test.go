@@ -0,0 +1,118 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 seed of the RFC 6238 test vectors, "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// the RFC lists 8 digit codes, the last 6 of them are the 6 digit codes
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{unix: 59, code: "287082"},
+		{unix: 1111111109, code: "081804"},
+		{unix: 1111111111, code: "050471"},
+		{unix: 1234567890, code: "005924"},
+		{unix: 2000000000, code: "279037"},
+		{unix: 20000000000, code: "353130"},
+	}
+	for _, test := range tests {
+		code, err := Code(rfcSecret, Step(time.Unix(test.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code(%d): %v", test.unix, err)
+		}
+		if code != test.code {
+			t.Errorf("Code(%d) = %s, want %s", test.unix, code, test.code)
+		}
+	}
+}
+
+func TestCodeLowercaseSecret(t *testing.T) {
+	upper, err := Code(rfcSecret, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lower, err := Code("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upper != lower {
+		t.Errorf("lowercase secret gave %s, want %s", lower, upper)
+	}
+}
+
+func TestCodeInvalidSecret(t *testing.T) {
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("expected an error for an invalid secret")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+	code := func(step int64) string {
+		code, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+	// wrong changes the last digit of a code
+	wrong := func(code string) string {
+		return code[:Digits-1] + string('0'+(code[Digits-1]-'0'+1)%10)
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		step     int64
+		ok       bool
+	}{
+		{name: "current step", code: code(current), lastStep: 0, step: current, ok: true},
+		{name: "previous step within skew", code: code(current - 1), lastStep: 0, step: current - 1, ok: true},
+		{name: "next step within skew", code: code(current + 1), lastStep: 0, step: current + 1, ok: true},
+		{name: "two steps behind", code: code(current - 2), lastStep: 0, ok: false},
+		{name: "two steps ahead", code: code(current + 2), lastStep: 0, ok: false},
+		{name: "spaces are ignored", code: code(current)[:3] + " " + code(current)[3:], lastStep: 0, step: current, ok: true},
+		{name: "replay of the last step", code: code(current), lastStep: current, ok: false},
+		{name: "replay of an earlier step", code: code(current - 1), lastStep: current - 1, ok: false},
+		{name: "later step after a replayed one", code: code(current + 1), lastStep: current, step: current + 1, ok: true},
+		{name: "wrong code", code: wrong(code(current)), lastStep: 0, ok: false},
+		{name: "too short", code: code(current)[:5], lastStep: 0, ok: false},
+		{name: "too long", code: code(current) + "0", lastStep: 0, ok: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, test.code, now, test.lastStep)
+			if ok != test.ok {
+				t.Fatalf("Validate ok = %v, want %v", ok, test.ok)
+			}
+			if ok && step != test.step {
+				t.Errorf("Validate step = %d, want %d", step, test.step)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := encoding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("secret is not base32: %v", err)
+	}
+	if len(key) != secretSize {
+		t.Errorf("secret has %d bytes, want %d", len(key), secretSize)
+	}
+	if _, err = Code(secret, 1); err != nil {
+		t.Errorf("cannot compute a code for a generated secret: %v", err)
+	}
+}
@@ -0,0 +1,20 @@
+package utilities
+
+import "github.com/lib/pq"
+
+const (
+	pgForeignKeyViolation = "23503"
+	pgUniqueViolation     = "23505"
+)
+
+// IsForeignKeyViolation reports whether a postgres error was caused by a missing referenced row
+func IsForeignKeyViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == pgForeignKeyViolation
+}
+
+// IsUniqueViolation reports whether a postgres error was caused by a duplicate key
+func IsUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == pgUniqueViolation
+}
@@ -0,0 +1,136 @@
+package utilities
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSetTrustedProxies(t *testing.T) {
+	tests := []struct {
+		config string
+		valid  bool
+	}{
+		{config: "", valid: true},
+		{config: "10.0.0.1", valid: true},
+		{config: " 10.0.0.1 , 10.1.0.0/16,,", valid: true},
+		{config: "2001:db8::1, 2001:db8:1::/48", valid: true},
+		{config: "10.0.0.300", valid: false},
+		{config: "10.0.0.0/33", valid: false},
+		{config: "proxy.internal", valid: false},
+	}
+	for _, test := range tests {
+		err := SetTrustedProxies(test.config)
+		if (err == nil) != test.valid {
+			t.Errorf("SetTrustedProxies(%q) error = %v, want valid %v", test.config, err, test.valid)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name         string
+		proxies      string
+		remoteAddr   string
+		forwardedFor []string
+		want         string
+	}{
+		{
+			name:       "no proxies configured",
+			remoteAddr: "203.0.113.7:5000",
+			want:       "203.0.113.7",
+		},
+		{
+			name:         "forwarded for is ignored without trusted proxies",
+			remoteAddr:   "203.0.113.7:5000",
+			forwardedFor: []string{"198.51.100.1"},
+			want:         "203.0.113.7",
+		},
+		{
+			name:         "forwarded for is ignored from an untrusted peer",
+			proxies:      "10.0.0.1",
+			remoteAddr:   "203.0.113.7:5000",
+			forwardedFor: []string{"198.51.100.1"},
+			want:         "203.0.113.7",
+		},
+		{
+			name:         "trusted proxy forwards the client",
+			proxies:      "10.0.0.1",
+			remoteAddr:   "10.0.0.1:5000",
+			forwardedFor: []string{"198.51.100.1"},
+			want:         "198.51.100.1",
+		},
+		{
+			name:         "spoofed entries left of the client are skipped",
+			proxies:      "10.0.0.1",
+			remoteAddr:   "10.0.0.1:5000",
+			forwardedFor: []string{"1.2.3.4, 198.51.100.1"},
+			want:         "198.51.100.1",
+		},
+		{
+			name:         "chain of trusted proxies",
+			proxies:      "10.0.0.0/8",
+			remoteAddr:   "10.0.0.1:5000",
+			forwardedFor: []string{"1.2.3.4, 198.51.100.1, 10.2.0.5, 10.1.0.9"},
+			want:         "198.51.100.1",
+		},
+		{
+			name:         "headers sent more than once are read as one list",
+			proxies:      "10.0.0.0/8",
+			remoteAddr:   "10.0.0.1:5000",
+			forwardedFor: []string{"1.2.3.4", "198.51.100.1, 10.2.0.5"},
+			want:         "198.51.100.1",
+		},
+		{
+			name:         "unparsable hop stops the walk at the last good one",
+			proxies:      "10.0.0.0/8",
+			remoteAddr:   "10.0.0.1:5000",
+			forwardedFor: []string{"198.51.100.1, garbage, 10.2.0.5"},
+			want:         "10.2.0.5",
+		},
+		{
+			name:         "only trusted proxies forwarded",
+			proxies:      "10.0.0.0/8",
+			remoteAddr:   "10.0.0.1:5000",
+			forwardedFor: []string{"10.2.0.5, 10.1.0.9"},
+			want:         "10.2.0.5",
+		},
+		{
+			name:       "trusted proxy without forwarded for",
+			proxies:    "10.0.0.1",
+			remoteAddr: "10.0.0.1:5000",
+			want:       "10.0.0.1",
+		},
+		{
+			name:         "ipv6 client behind an ipv6 proxy",
+			proxies:      "2001:db8::/32",
+			remoteAddr:   "[2001:db8::1]:5000",
+			forwardedFor: []string{"2001:db8:ffff::2, 2a00:1450::1"},
+			want:         "2a00:1450::1",
+		},
+		{
+			name:       "remote address without a port",
+			remoteAddr: "203.0.113.7",
+			want:       "203.0.113.7",
+		},
+	}
+	defer func() {
+		if err := SetTrustedProxies(""); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := SetTrustedProxies(test.proxies); err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = test.remoteAddr
+			for _, forwardedFor := range test.forwardedFor {
+				r.Header.Add("X-Forwarded-For", forwardedFor)
+			}
+			if got := ClientIP(r); got != test.want {
+				t.Errorf("ClientIP = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
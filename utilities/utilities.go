@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"github.com/sirupsen/logrus"
 	"net/http"
+	"regexp"
+	"strings"
 )
 
 type Key string
@@ -30,3 +32,17 @@ func Encoder(w http.ResponseWriter, inter interface{}) error {
 	}
 	return nil
 }
+
+var (
+	slugSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+	slugPattern    = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+)
+
+// Slugify turns a name into the lower case, dash separated form used in urls
+func Slugify(name string) string {
+	return strings.Trim(slugSeparators.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+func IsSlug(slug string) bool {
+	return slugPattern.MatchString(slug)
+}